@@ -0,0 +1,175 @@
+package xlog
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var (
+	ErrQueueFull = errors.New("queue full")
+)
+
+// AsyncOptions defines several options of AsyncPoolOutput.
+type AsyncOptions struct {
+	// Workers is the number of the goroutines writing the logs to the output. By default, runtime.GOMAXPROCS(0).
+	Workers int
+
+	// MaxPending is the maximum number of the logs which aren't written yet. By default, 1024.
+	MaxPending int
+
+	// KeyFunc assigns the logs which have the same key to the same worker, so they are written in order. By default,
+	// nil that means the logs are distributed to the workers in turn without ordering guarantee.
+	KeyFunc KeyFunc
+
+	// Block blocks Log method until the number of pending logs falls below MaxPending. By default, false that means
+	// the logs exceeding MaxPending are dropped.
+	Block bool
+}
+
+// AsyncPoolOutput is an implementation of Output that writes the logs to the given output asynchronously by a bounded
+// pool of workers.
+type AsyncPoolOutput struct {
+	dropped uint64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
+	mu      sync.RWMutex
+	output  Output
+	opts    AsyncOptions
+	pending chan struct{}
+	queues  []chan *Log
+	next    uint32
+	wg      sync.WaitGroup
+	closed  bool
+	onError *func(error)
+}
+
+// NewAsyncPoolOutput creates a new AsyncPoolOutput by the given output, and starts the workers.
+func NewAsyncPoolOutput(output Output, opts AsyncOptions) (a *AsyncPoolOutput) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 1024
+	}
+	a = &AsyncPoolOutput{
+		output:  output,
+		opts:    opts,
+		pending: make(chan struct{}, opts.MaxPending),
+		queues:  make([]chan *Log, opts.Workers),
+	}
+	for i := range a.queues {
+		a.queues[i] = make(chan *Log, opts.MaxPending)
+		a.wg.Add(1)
+		go a.worker(a.queues[i])
+	}
+	return
+}
+
+// AsyncOutput creates an output that doesn't block its logs to the provided output.
+// It returns a new AsyncPoolOutput with the default options except Block, so it never drops the logs, and it blocks
+// only when the number of pending logs reaches MaxPending.
+func AsyncOutput(output Output) Output {
+	return NewAsyncPoolOutput(output, AsyncOptions{Block: true})
+}
+
+// Close closes AsyncPoolOutput and the underlying output after writing the pending logs.
+func (a *AsyncPoolOutput) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		for _, queue := range a.queues {
+			close(queue)
+		}
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+	return closeOutput(a.output)
+}
+
+// Flush is implementation of Flusher.
+// It waits until the pending logs are written, and then flushes the underlying output.
+func (a *AsyncPoolOutput) Flush(ctx context.Context) error {
+	for len(a.pending) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return flushOutput(ctx, a.output)
+}
+
+// Log is implementation of Output.
+// If the number of pending logs has reached MaxPending, it blocks or drops the log by the Block option. It reports
+// ErrQueueFull to OnError function for the dropped logs.
+func (a *AsyncPoolOutput) Log(log *Log) {
+	if a.opts.Block {
+		a.pending <- struct{}{}
+	} else {
+		select {
+		case a.pending <- struct{}{}:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+			log.Release()
+			reportError(&a.onError, ErrQueueFull)
+			return
+		}
+	}
+	var idx uint32
+	if a.opts.KeyFunc != nil {
+		idx = asyncKeyHash(a.opts.KeyFunc(log))
+	} else {
+		idx = atomic.AddUint32(&a.next, 1)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		<-a.pending
+		log.Release()
+		return
+	}
+	a.queues[idx%uint32(len(a.queues))] <- log
+}
+
+// Dropped returns the number of the logs dropped because of MaxPending.
+func (a *AsyncPoolOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// SetOnError sets a function to call when a log is dropped.
+// It returns underlying AsyncPoolOutput.
+func (a *AsyncPoolOutput) SetOnError(f func(error)) *AsyncPoolOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&a.onError)), unsafe.Pointer(&f))
+	return a
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (a *AsyncPoolOutput) SetErrorReporter(f func(error)) {
+	a.SetOnError(f)
+	setErrorReporter(a.output, f)
+}
+
+func (a *AsyncPoolOutput) worker(queue chan *Log) {
+	defer a.wg.Done()
+	for log := range queue {
+		a.output.Log(log)
+		<-a.pending
+	}
+}
+
+// asyncKeyHash returns the FNV-1a hash of the key.
+func asyncKeyHash(key string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return h
+}
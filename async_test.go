@@ -0,0 +1,117 @@
+package xlog_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+// orderOutput records the messages of the logs per key field.
+type orderOutput struct {
+	mu       sync.Mutex
+	messages map[string][]string
+	gate     chan struct{}
+}
+
+func (o *orderOutput) Log(log *xlog.Log) {
+	if o.gate != nil {
+		<-o.gate
+	}
+	o.mu.Lock()
+	key := log.Fields[0].Value.(string)
+	o.messages[key] = append(o.messages[key], string(log.Message))
+	o.mu.Unlock()
+	log.Release()
+}
+
+func TestAsyncPoolOutput_ordering(t *testing.T) {
+	output := &orderOutput{messages: make(map[string][]string)}
+	async := xlog.NewAsyncPoolOutput(output, xlog.AsyncOptions{
+		Workers:    4,
+		MaxPending: 64,
+		KeyFunc:    xlog.KeyByField("key"),
+		Block:      true,
+	})
+	logger := xlog.New(async, xlog.SeverityInfo, 0)
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 100; i++ {
+		for _, key := range keys {
+			logger.WithFieldKeyVals("key", key).Info(strconv.Itoa(i))
+		}
+	}
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		messages := output.messages[key]
+		if len(messages) != 100 {
+			t.Fatalf("key %q has %d logs, want 100", key, len(messages))
+		}
+		for i, msg := range messages {
+			if msg != strconv.Itoa(i) {
+				t.Fatalf("key %q log %d is %q", key, i, msg)
+			}
+		}
+	}
+}
+
+func TestAsyncPoolOutput_maxPending(t *testing.T) {
+	output := &orderOutput{messages: make(map[string][]string), gate: make(chan struct{})}
+	var errCount int
+	async := xlog.NewAsyncPoolOutput(output, xlog.AsyncOptions{
+		Workers:    2,
+		MaxPending: 4,
+	}).SetOnError(func(err error) {
+		if errors.Is(err, xlog.ErrQueueFull) {
+			errCount++
+		}
+	})
+	logger := xlog.New(async, xlog.SeverityInfo, 0).WithFieldKeyVals("key", "a")
+	for i := 0; i < 10; i++ {
+		logger.Info("max pending.")
+	}
+	if n := async.Dropped(); n != 6 {
+		t.Errorf("dropped %d logs, want 6", n)
+	}
+	if errCount != 6 {
+		t.Errorf("reported %d errors, want 6", errCount)
+	}
+	close(output.gate)
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := async.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	output.mu.Lock()
+	n := len(output.messages["a"])
+	output.mu.Unlock()
+	if n != 4 {
+		t.Errorf("written %d logs, want 4", n)
+	}
+	_ = async.Close()
+	logger.Info("closed.")
+}
+
+func TestAsyncOutput(t *testing.T) {
+	output := &orderOutput{messages: make(map[string][]string)}
+	async := xlog.AsyncOutput(output).(*xlog.AsyncPoolOutput)
+	logger := xlog.New(async, xlog.SeverityInfo, 0).WithFieldKeyVals("key", "a")
+	for i := 0; i < 2000; i++ {
+		logger.Info("never dropped.")
+	}
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := async.Dropped(); n != 0 {
+		t.Errorf("dropped %d logs, want 0", n)
+	}
+	if n := len(output.messages["a"]); n != 2000 {
+		t.Errorf("written %d logs, want 2000", n)
+	}
+}
@@ -0,0 +1,242 @@
+package xlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+var (
+	ErrAuditInvalid  = errors.New("invalid audit record")
+	ErrAuditGap      = errors.New("gap in audit records")
+	ErrAuditReorder  = errors.New("reordered audit records")
+	ErrAuditTampered = errors.New("tampered audit record")
+)
+
+// AuditChain is the state of the hash chain of the audit records: the sequence number and the hash of the last
+// record. The zero value is the state before the first record.
+type AuditChain struct {
+	Seq  uint64
+	Hash []byte
+}
+
+// AuditError is the error of VerifyAudit. It wraps one of ErrAuditInvalid, ErrAuditGap, ErrAuditReorder and
+// ErrAuditTampered.
+type AuditError struct {
+	Line int
+	Seq  uint64
+	Err  error
+}
+
+// Error is implementation of error.
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("line %d, seq %d: %v", e.Line, e.Seq, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *AuditError) Unwrap() error {
+	return e.Err
+}
+
+// auditRecord is the JSON form of an audit record.
+type auditRecord struct {
+	Seq  uint64          `json:"seq"`
+	Prev string          `json:"prev"`
+	Hash string          `json:"hash"`
+	Log  json.RawMessage `json:"log"`
+}
+
+// AuditOutput is an implementation of ErrorOutput that writes the logs as tamper-evident audit records to the given
+// writer. Every record is a JSON line which has a sequence number, the hash of the previous record, the JSON form of
+// the Log and its own hash. The hash of a record is computed over the previous hash, the sequence number and the
+// JSON form of the Log, by HMAC-SHA256 if the key is given, otherwise by SHA-256. Any modification, removal or
+// reordering of the records breaks the chain, and it is detected by VerifyAudit.
+type AuditOutput struct {
+	mu      sync.Mutex
+	w       io.Writer
+	key     []byte
+	chain   AuditChain
+	onError *func(error)
+}
+
+// NewAuditOutput creates a new AuditOutput by the given writer and key. The argument chain is the state of the last
+// record to continue an existing audit log, it is returned by VerifyAudit. It should be the zero value for a new
+// audit log.
+func NewAuditOutput(w io.Writer, key []byte, chain AuditChain) *AuditOutput {
+	return &AuditOutput{
+		w:   w,
+		key: append([]byte(nil), key...),
+		chain: AuditChain{
+			Seq:  chain.Seq,
+			Hash: append([]byte(nil), chain.Hash...),
+		},
+	}
+}
+
+// Log is implementation of Output.
+func (a *AuditOutput) Log(log *Log) {
+	err := a.TryLog(log)
+	log.Release()
+	if err != nil {
+		reportError(&a.onError, err)
+	}
+}
+
+// TryLog is implementation of ErrorOutput.
+// The chain doesn't advance if writing the record fails.
+func (a *AuditOutput) TryLog(log *Log) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("unable to encode log: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	seq := a.chain.Seq + 1
+	sum := auditHash(a.key, a.chain.Hash, seq, data)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.b = append(buf.b, `{"seq":`...)
+	buf.b = strconv.AppendUint(buf.b, seq, 10)
+	buf.b = append(buf.b, `,"prev":"`...)
+	buf.b = appendHex(buf.b, a.chain.Hash)
+	buf.b = append(buf.b, `","hash":"`...)
+	buf.b = appendHex(buf.b, sum)
+	buf.b = append(buf.b, `","log":`...)
+	buf.b = append(buf.b, data...)
+	buf.b = append(buf.b, "}\n"...)
+	if _, err := a.w.Write(buf.b); err != nil {
+		return fmt.Errorf("unable to write audit record: %w", err)
+	}
+	a.chain = AuditChain{Seq: seq, Hash: sum}
+	return nil
+}
+
+// Chain returns the state of the last record.
+func (a *AuditOutput) Chain() AuditChain {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AuditChain{
+		Seq:  a.chain.Seq,
+		Hash: append([]byte(nil), a.chain.Hash...),
+	}
+}
+
+// Flush is implementation of Flusher.
+// It syncs the writer if it has Sync method like *os.File.
+func (a *AuditOutput) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s, ok := a.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close is implementation of Closer.
+// It flushes AuditOutput, but doesn't close the underlying writer.
+func (a *AuditOutput) Close() error {
+	return a.Flush(context.Background())
+}
+
+// SetOnError sets a function to call when error occurs.
+// It returns underlying AuditOutput.
+func (a *AuditOutput) SetOnError(f func(error)) *AuditOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&a.onError)), unsafe.Pointer(&f))
+	return a
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (a *AuditOutput) SetErrorReporter(f func(error)) {
+	a.SetOnError(f)
+}
+
+// VerifyAudit verifies the audit records written by AuditOutput with the given key, from the beginning of the audit
+// log. It returns the state of the last record, and *AuditError for the first broken record. The removal of the last
+// records can't be detected by the chain itself, so the returned state should be compared with a state kept
+// elsewhere.
+func VerifyAudit(r io.Reader, key []byte) (AuditChain, error) {
+	var chain AuditChain
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var record auditRecord
+			if e := json.Unmarshal(data, &record); e != nil {
+				return chain, &AuditError{Line: line, Seq: chain.Seq + 1, Err: fmt.Errorf("%w: %v", ErrAuditInvalid, e)}
+			}
+			if e := verifyAuditRecord(&record, key, &chain); e != nil {
+				return chain, &AuditError{Line: line, Seq: record.Seq, Err: e}
+			}
+		}
+		if err == io.EOF {
+			return chain, nil
+		}
+		if err != nil {
+			return chain, err
+		}
+	}
+}
+
+// verifyAuditRecord verifies the record by the state of the previous record, and advances the state.
+func verifyAuditRecord(record *auditRecord, key []byte, chain *AuditChain) error {
+	switch {
+	case record.Seq <= chain.Seq:
+		return ErrAuditReorder
+	case record.Seq > chain.Seq+1:
+		return fmt.Errorf("%w: %d records are missing", ErrAuditGap, record.Seq-chain.Seq-1)
+	}
+	prev, err := hex.DecodeString(record.Prev)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditInvalid, err)
+	}
+	sum, err := hex.DecodeString(record.Hash)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditInvalid, err)
+	}
+	if !hmac.Equal(prev, chain.Hash) {
+		return fmt.Errorf("%w: previous hash mismatch", ErrAuditTampered)
+	}
+	if !hmac.Equal(sum, auditHash(key, prev, record.Seq, record.Log)) {
+		return fmt.Errorf("%w: hash mismatch", ErrAuditTampered)
+	}
+	chain.Seq, chain.Hash = record.Seq, sum
+	return nil
+}
+
+// auditHash returns the hash of an audit record.
+func auditHash(key []byte, prev []byte, seq uint64, data []byte) []byte {
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	_, _ = h.Write(prev)
+	_, _ = h.Write(seqBytes[:])
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+func appendHex(b []byte, data []byte) []byte {
+	for _, c := range data {
+		b = append(b, escapeHex[c>>4], escapeHex[c&0xf])
+	}
+	return b
+}
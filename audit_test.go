@@ -0,0 +1,84 @@
+package xlog_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goinsane/xlog"
+)
+
+func writeAuditLog(t *testing.T, key []byte, n int) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	output := xlog.NewAuditOutput(&buf, key, xlog.AuditChain{})
+	output.SetOnError(func(err error) { t.Error(err) })
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	for i := 0; i < n; i++ {
+		logger.WithFieldKeyVals("i", i).Infof("record %d", i)
+	}
+	if chain := output.Chain(); chain.Seq != uint64(n) {
+		t.Fatalf("seq = %d, want %d", chain.Seq, n)
+	}
+	return &buf
+}
+
+func TestVerifyAudit(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("secret")} {
+		buf := writeAuditLog(t, key, 5)
+		chain, err := xlog.VerifyAudit(bytes.NewReader(buf.Bytes()), key)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if chain.Seq != 5 || len(chain.Hash) == 0 {
+			t.Errorf("key %q: unexpected chain %+v", key, chain)
+		}
+	}
+}
+
+func TestVerifyAudit_resume(t *testing.T) {
+	buf := writeAuditLog(t, nil, 3)
+	chain, err := xlog.VerifyAudit(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := xlog.New(xlog.NewAuditOutput(buf, nil, chain), xlog.SeverityInfo, 0)
+	logger.Info("resumed")
+	chain, err = xlog.VerifyAudit(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Seq != 4 {
+		t.Errorf("seq = %d, want 4", chain.Seq)
+	}
+}
+
+func TestVerifyAudit_broken(t *testing.T) {
+	key := []byte("secret")
+	lines := strings.SplitAfter(writeAuditLog(t, key, 4).String(), "\n")[:4]
+	tests := []struct {
+		name  string
+		lines []string
+		key   []byte
+		err   error
+		seq   uint64
+	}{
+		{"gap", []string{lines[0], lines[2], lines[3]}, key, xlog.ErrAuditGap, 3},
+		{"reorder", []string{lines[0], lines[1], lines[0]}, key, xlog.ErrAuditReorder, 1},
+		{"modified", []string{lines[0], strings.Replace(lines[1], "record 1", "record X", 1)}, key, xlog.ErrAuditTampered, 2},
+		{"wrong key", lines, []byte("other"), xlog.ErrAuditTampered, 1},
+		{"invalid", []string{lines[0], "{\n"}, key, xlog.ErrAuditInvalid, 2},
+	}
+	for _, tt := range tests {
+		_, err := xlog.VerifyAudit(strings.NewReader(strings.Join(tt.lines, "")), tt.key)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		var auditErr *xlog.AuditError
+		if !errors.As(err, &auditErr) || auditErr.Seq != tt.seq {
+			t.Errorf("%s: error = %v, want seq %d", tt.name, err, tt.seq)
+		}
+	}
+}
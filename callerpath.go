@@ -0,0 +1,291 @@
+package xlog
+
+import (
+	"go/build"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goinsane/erf"
+)
+
+// CallerPathMode defines how the Outputs write the file paths of StackCaller and StackTrace, and the function names of
+// StackCaller.
+type CallerPathMode int
+
+const (
+	// CallerPathGopath trims GOROOT/src and GOPATH/src from the file paths: /home/ci/work/svc/internal/x.go
+	CallerPathGopath CallerPathMode = iota
+
+	// CallerPathModule writes the file paths under the module paths: github.com/acme/svc/internal/x.go
+	CallerPathModule
+
+	// CallerPathModuleRelative writes the file paths of the main module relative to the main module root, and the
+	// others like CallerPathModule: internal/x.go
+	CallerPathModuleRelative
+
+	// CallerPathModuleVersion is like CallerPathModuleRelative, but writes the file paths of the dependencies with
+	// their versions: github.com/foo/bar@v1.2.3/bar.go
+	CallerPathModuleVersion
+)
+
+// moduleFile is the module information of a source file.
+type moduleFile struct {
+	ok      bool
+	path    string
+	version string
+	main    bool
+	rel     string
+}
+
+var (
+	buildInfoOnce   sync.Once
+	buildInfoPath   string
+	buildInfoMain   string
+	buildInfoDeps   map[string]string
+	moduleFiles     sync.Map
+	callerPathCache sync.Map
+)
+
+type callerPathKey struct {
+	file string
+	mode CallerPathMode
+}
+
+// callerPath returns the path of the file of the caller function by the mode. The results are cached, so it doesn't
+// allocate for a known path.
+func callerPath(file string, function string, mode CallerPathMode) string {
+	if mode == CallerPathGopath || file == "" {
+		return trimSrcPath(file)
+	}
+	key := callerPathKey{file: file, mode: mode}
+	if p, ok := callerPathCache.Load(key); ok {
+		return p.(string)
+	}
+	p := trimSrcPath(file)
+	m, ok := lookupModuleFile(file, function)
+	if !ok {
+		// the function is needed to resolve the file, don't cache.
+		return p
+	}
+	if m.ok {
+		switch {
+		case m.main && mode != CallerPathModule:
+			p = m.rel
+		case !m.main && mode == CallerPathModuleVersion && m.version != "":
+			p = m.path + "@" + m.version + "/" + m.rel
+		default:
+			p = m.path + "/" + m.rel
+		}
+	}
+	callerPathCache.Store(key, p)
+	return p
+}
+
+type callerFuncKey struct {
+	function string
+	file     string
+	mode     CallerPathMode
+}
+
+// callerFunc returns the function name of the caller in the given file by the mode, consistently with callerPath:
+// the functions of the main module are relative to the main module by CallerPathModuleRelative and
+// CallerPathModuleVersion, and the functions of the dependencies have their versions by CallerPathModuleVersion.
+// The results are cached, so it doesn't allocate for a known function.
+func callerFunc(function string, file string, mode CallerPathMode) string {
+	if mode == CallerPathGopath || function == "" || file == "" {
+		return trimSrcPath(function)
+	}
+	key := callerFuncKey{function: function, file: file, mode: mode}
+	if f, ok := callerPathCache.Load(key); ok {
+		return f.(string)
+	}
+	f := trimSrcPath(function)
+	if m, _ := lookupModuleFile(file, function); m.ok && strings.HasPrefix(f, m.path) && len(f) > len(m.path) &&
+		(f[len(m.path)] == '/' || f[len(m.path)] == '.') {
+		switch {
+		case m.main && mode != CallerPathModule && f[len(m.path)] == '/':
+			f = f[len(m.path)+1:]
+		case !m.main && mode == CallerPathModuleVersion && m.version != "":
+			f = m.path + "@" + m.version + f[len(m.path):]
+		}
+	}
+	callerPathCache.Store(key, f)
+	return f
+}
+
+// lookupModuleFile returns the module information of the source file of the function. It returns false if the
+// module information can't be resolved without the function.
+func lookupModuleFile(file string, function string) (moduleFile, bool) {
+	if m, ok := moduleFiles.Load(file); ok {
+		return m.(moduleFile), true
+	}
+	buildInfoOnce.Do(loadBuildInfo)
+	m, ok := resolveModuleFile(filepath.ToSlash(file), function)
+	if !ok {
+		return m, false
+	}
+	if m.ok {
+		m.main = m.path == buildInfoMain
+		if m.version == "" && !m.main {
+			m.version = buildInfoDeps[m.path]
+		}
+	}
+	moduleFiles.Store(file, m)
+	return m, true
+}
+
+func loadBuildInfo() {
+	buildInfoDeps = make(map[string]string)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	buildInfoPath = info.Path
+	buildInfoMain = info.Main.Path
+	for _, dep := range info.Deps {
+		buildInfoDeps[dep.Path] = dep.Version
+	}
+}
+
+// resolveModuleFile resolves the module information of the source file by its path. If the file isn't in the module
+// cache, it resolves by the package of the function and the build information, so it doesn't need the sources on the
+// disk. It returns false if the function is needed but empty.
+func resolveModuleFile(file string, function string) (moduleFile, bool) {
+	if !strings.HasPrefix(file, "/") && !filepath.IsAbs(file) {
+		// built with -trimpath: the main module and the replaced modules are under their module paths, the others
+		// are under module@version.
+		if m, ok := parseModuleVersionPath(file); ok {
+			return m, true
+		}
+		if modPath, ok := lookupModulePath(file); ok {
+			return moduleFile{ok: true, path: modPath, rel: file[len(modPath)+1:]}, true
+		}
+		return moduleFile{}, true
+	}
+	if idx := strings.LastIndex(file, "/pkg/mod/"); idx >= 0 {
+		if m, ok := parseModuleVersionPath(file[idx+len("/pkg/mod/"):]); ok {
+			return m, true
+		}
+	}
+	if strings.HasPrefix(file, filepath.ToSlash(build.Default.GOROOT)+"/src/") {
+		return moduleFile{}, true
+	}
+	if function == "" {
+		return moduleFile{}, false
+	}
+	pkg := packagePath(function)
+	modPath, ok := lookupModulePath(pkg + "/")
+	if !ok {
+		return moduleFile{}, true
+	}
+	// the file must be in the directory of the package.
+	pkgDir := strings.TrimPrefix(pkg[len(modPath):], "/")
+	if pkgDir != "" && !strings.HasSuffix(path.Dir(file), "/"+pkgDir) {
+		return moduleFile{}, true
+	}
+	return moduleFile{ok: true, path: modPath, rel: path.Join(pkgDir, path.Base(file))}, true
+}
+
+// lookupModulePath returns the longest path of the main module or the dependencies which the path p is under.
+func lookupModulePath(p string) (string, bool) {
+	var modPath string
+	if buildInfoMain != "" && strings.HasPrefix(p, buildInfoMain+"/") {
+		modPath = buildInfoMain
+	}
+	for dep := range buildInfoDeps {
+		if strings.HasPrefix(p, dep+"/") && len(dep) > len(modPath) {
+			modPath = dep
+		}
+	}
+	return modPath, modPath != ""
+}
+
+// packagePath returns the import path of the package of the function, e.g. github.com/acme/svc/internal for
+// github.com/acme/svc/internal.(*T).Method.func1. The package main is resolved by the build information, and the
+// external test packages are resolved to the packages under test.
+func packagePath(function string) string {
+	if idx := strings.IndexByte(function, '['); idx >= 0 {
+		function = function[:idx]
+	}
+	slash := strings.LastIndexByte(function, '/')
+	pkg := function
+	if idx := strings.IndexByte(function[slash+1:], '.'); idx >= 0 {
+		pkg = function[:slash+1+idx]
+	}
+	if pkg == "main" {
+		return buildInfoPath
+	}
+	return strings.TrimSuffix(pkg, "_test")
+}
+
+// parseModuleVersionPath parses the path like module@version/rel in the module cache.
+func parseModuleVersionPath(file string) (moduleFile, bool) {
+	at := strings.IndexByte(file, '@')
+	if at <= 0 {
+		return moduleFile{}, false
+	}
+	slash := strings.IndexByte(file[at:], '/')
+	if slash < 0 {
+		return moduleFile{}, false
+	}
+	return moduleFile{
+		ok:      true,
+		path:    unescapeModulePath(file[:at]),
+		version: file[at+1 : at+slash],
+		rel:     file[at+slash+1:],
+	}, true
+}
+
+// unescapeModulePath decodes the case-encoded module path in the module cache: !foo -> Foo.
+func unescapeModulePath(path string) string {
+	if strings.IndexByte(path, '!') < 0 {
+		return path
+	}
+	b := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '!' && i+1 < len(path) {
+			i++
+			b = append(b, path[i]-'a'+'A')
+			continue
+		}
+		b = append(b, path[i])
+	}
+	return string(b)
+}
+
+// appendStackTrace appends the stack trace like fmt.Sprintf("%+1.1s", stackTrace) to b, and writes the file paths
+// by the mode.
+func appendStackTrace(b []byte, stackTrace *erf.StackTrace, mode CallerPathMode) []byte {
+	for i, n := 0, stackTrace.Len(); i < n; i++ {
+		c := stackTrace.Caller(i)
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		fn := "???"
+		if c.Function != "" {
+			fn = trimSrcPath(c.Function)
+		}
+		b = append(b, '\t')
+		b = append(b, fn...)
+		b = append(b, "(0x"...)
+		b = strconv.AppendUint(b, uint64(c.Entry), 16)
+		b = append(b, ")\n\t\t"...)
+		file, line := "???", 0
+		if c.File != "" {
+			file = callerPath(c.File, c.Function, mode)
+		}
+		if c.Line > 0 {
+			line = c.Line
+		}
+		b = append(b, file...)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(line), 10)
+		b = append(b, " +0x"...)
+		b = strconv.AppendUint(b, uint64(c.PC-c.Entry), 16)
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package xlog_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/goinsane/erf"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestTextOutput_SetCallerPathMode(t *testing.T) {
+	pc, file, line, _ := runtime.Caller(0)
+	function := runtime.FuncForPC(pc).Name()
+	dependency := "/home/user/go/pkg/mod/github.com/!foo/bar@v1.2.3/baz/bar.go"
+	// the sources aren't needed on the disk.
+	removed := "/nonexistent/xlog/callerpath_test.go"
+	for _, test := range []struct {
+		mode xlog.CallerPathMode
+		file string
+		want string
+	}{
+		{xlog.CallerPathGopath, file, file},
+		{xlog.CallerPathModule, file, "github.com/goinsane/xlog/callerpath_test.go"},
+		{xlog.CallerPathModuleRelative, file, "callerpath_test.go"},
+		{xlog.CallerPathModuleVersion, file, "callerpath_test.go"},
+		{xlog.CallerPathModule, removed, "github.com/goinsane/xlog/callerpath_test.go"},
+		{xlog.CallerPathGopath, dependency, dependency},
+		{xlog.CallerPathModule, dependency, "github.com/Foo/bar/baz/bar.go"},
+		{xlog.CallerPathModuleRelative, dependency, "github.com/Foo/bar/baz/bar.go"},
+		{xlog.CallerPathModuleVersion, dependency, "github.com/Foo/bar@v1.2.3/baz/bar.go"},
+	} {
+		var buf bytes.Buffer
+		output := xlog.NewTextOutput(&buf).SetCallerPathMode(test.mode)
+		log := &xlog.Log{
+			Message:     []byte("caller path."),
+			Severity:    xlog.SeverityInfo,
+			StackCaller: erf.StackCaller{Frame: runtime.Frame{File: test.file, Line: line, Function: function}},
+			Flags:       xlog.FlagLongFile,
+		}
+		if err := output.TryLog(log); err != nil {
+			t.Fatal(err)
+		}
+		want := test.want + ":" + strconv.Itoa(line) + " - caller path.\n"
+		if got := buf.String(); got != want {
+			t.Errorf("mode %d: %q, want %q", test.mode, got, want)
+		}
+	}
+}
+
+func TestLayout_funcCallerPathMode(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	internal := filepath.Join(filepath.Dir(file), "internal", "x.go")
+	dependency := "/home/user/go/pkg/mod/github.com/!foo/bar@v1.2.3/baz/bar.go"
+	layout := xlog.MustParseLayout("%caller{long} %func{long}\n")
+	for _, test := range []struct {
+		mode     xlog.CallerPathMode
+		file     string
+		function string
+		want     string
+	}{
+		{xlog.CallerPathModule, internal, "github.com/goinsane/xlog/internal.Func", "github.com/goinsane/xlog/internal/x.go:1 github.com/goinsane/xlog/internal.Func"},
+		{xlog.CallerPathModuleRelative, internal, "github.com/goinsane/xlog/internal.Func", "internal/x.go:1 internal.Func"},
+		{xlog.CallerPathModuleRelative, file, "github.com/goinsane/xlog_test.Func", "callerpath_test.go:1 github.com/goinsane/xlog_test.Func"},
+		{xlog.CallerPathModuleRelative, dependency, "github.com/Foo/bar/baz.Func", "github.com/Foo/bar/baz/bar.go:1 github.com/Foo/bar/baz.Func"},
+		{xlog.CallerPathModuleVersion, dependency, "github.com/Foo/bar/baz.Func", "github.com/Foo/bar@v1.2.3/baz/bar.go:1 github.com/Foo/bar@v1.2.3/baz.Func"},
+	} {
+		var buf bytes.Buffer
+		output := xlog.NewTextOutput(&buf).SetCallerPathMode(test.mode).SetLayout(layout)
+		log := &xlog.Log{
+			Severity:    xlog.SeverityInfo,
+			StackCaller: erf.StackCaller{Frame: runtime.Frame{File: test.file, Line: 1, Function: test.function}},
+		}
+		if err := output.TryLog(log); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want+"\n" {
+			t.Errorf("mode %d: %q, want %q", test.mode, got, test.want+"\n")
+		}
+	}
+}
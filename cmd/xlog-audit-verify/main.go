@@ -0,0 +1,83 @@
+// Command xlog-audit-verify verifies the audit logs written by xlog.AuditOutput.
+//
+// Usage:
+//
+//	xlog-audit-verify [-key KEY | -key-file FILE] [-seq SEQ] FILE...
+//
+// It prints the sequence number and the hash of the last record of every file, and exits with status 1 if any file
+// is broken. If -seq is given, it also fails when the last sequence number differs, to detect removed last records.
+// A single trailing newline of the key file is ignored, as editors and echo add it.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/goinsane/xlog"
+)
+
+func main() {
+	key := flag.String("key", "", "HMAC key")
+	keyFile := flag.String("key-file", "", "file that contains HMAC key")
+	seq := flag.Uint64("seq", 0, "expected sequence number of the last record")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-key KEY | -key-file FILE] [-seq SEQ] FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	k := []byte(*key)
+	if *keyFile != "" {
+		var err error
+		k, err = readKeyFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	status := 0
+	for _, name := range flag.Args() {
+		if err := verify(name, k, *seq); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func verify(name string, key []byte, seq uint64) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	chain, err := xlog.VerifyAudit(f, key)
+	if err != nil {
+		return err
+	}
+	if seq > 0 && chain.Seq != seq {
+		return fmt.Errorf("last seq %d, want %d", chain.Seq, seq)
+	}
+	fmt.Printf("%s: OK seq %d hash %s\n", name, chain.Seq, hex.EncodeToString(chain.Hash))
+	return nil
+}
+
+// readKeyFile reads the key from the file by trimming a single trailing newline.
+func readKeyFile(name string) ([]byte, error) {
+	key, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimSuffix(key, []byte("\n"))
+	key = bytes.TrimSuffix(key, []byte("\r"))
+	return key, nil
+}
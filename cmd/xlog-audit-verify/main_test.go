@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestReadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog-audit-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, content := range []string{"secret", "secret\n", "secret\r\n"} {
+		name := filepath.Join(dir, "key")
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := readKeyFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(key) != "secret" {
+			t.Errorf("%q: key = %q", content, key)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog-audit-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	logger := xlog.New(xlog.NewAuditOutput(&buf, []byte("secret"), xlog.AuditChain{}), xlog.SeverityInfo, 0)
+	logger.Info("first")
+	logger.Info("second")
+	name := filepath.Join(dir, "audit.log")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := readKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(name, key, 2); err != nil {
+		t.Error(err)
+	}
+	if err := verify(name, key, 3); err == nil {
+		t.Error("expected error for the last seq")
+	}
+	if err := verify(name, []byte("secret\n"), 0); err == nil {
+		t.Error("expected error for the wrong key")
+	}
+}
@@ -0,0 +1,90 @@
+package xlog
+
+import (
+	"io"
+	"os"
+)
+
+// ColorMode defines whether a TextOutput colorizes its text with ANSI escape codes.
+type ColorMode int
+
+const (
+	// ColorNever never colorizes
+	ColorNever ColorMode = iota
+
+	// ColorAuto colorizes if the writer is a terminal and the environment variable NO_COLOR isn't set
+	ColorAuto
+
+	// ColorAlways always colorizes
+	ColorAlways
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorDim   = "\x1b[2m"
+	colorKey   = "\x1b[36m"
+)
+
+// textFormat holds the options of the text form of Log other than flags. The zero value is the default text form.
+type textFormat struct {
+	color       bool
+	alignFields bool
+	time        TimeFormat
+	callerPath  CallerPathMode
+	escape      EscapeMode
+}
+
+var defaultTextFormat textFormat
+
+// NewConsoleOutput creates a new TextOutput for the terminals. It colorizes by ColorAuto, and aligns the fields.
+func NewConsoleOutput(w io.Writer) *TextOutput {
+	return NewTextOutput(w).SetColorMode(ColorAuto).SetAlignFields(true)
+}
+
+// severityColor returns the ANSI escape code of the severity.
+func severityColor(severity Severity) string {
+	switch severity {
+	case SeverityFatal:
+		return "\x1b[1;31m"
+	case SeverityPanic:
+		return "\x1b[1;35m"
+	case SeverityError:
+		return "\x1b[31m"
+	case SeverityWarning:
+		return "\x1b[33m"
+	case SeverityInfo:
+		return "\x1b[32m"
+	case SeverityDebug:
+		return "\x1b[34m"
+	default:
+		return colorReset
+	}
+}
+
+// resolveColor returns whether to colorize the text written to w by the color mode.
+func resolveColor(mode ColorMode, w io.Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorAuto:
+		if noColor := os.Getenv("NO_COLOR"); noColor != "" {
+			return false
+		}
+		return isTerminal(w)
+	default:
+		return false
+	}
+}
+
+// isTerminal returns whether w is a character device like a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,46 @@
+package xlog_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestTextOutput_SetColorMode(t *testing.T) {
+	var buf bytes.Buffer
+	output := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity | xlog.FlagPadding | xlog.FlagShortFile | xlog.FlagFields)
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	output.SetColorMode(xlog.ColorAlways)
+	_, _, line, _ := runtime.Caller(0)
+	logger.WithFieldKeyVals("key", "value").Warning("line1\nline2")
+	want := fmt.Sprintf("\x1b[33mWARNING\x1b[0m - \x1b[2mconsole_test.go:%d - \x1b[0mline1\n          line2\n", line+1) +
+		"\t\n\t+ \x1b[36m\"key\"\x1b[0m=\"value\"\n\t\n"
+	if got := buf.String(); got != want {
+		t.Errorf("colored output\n%q\nwant\n%q", got, want)
+	}
+
+	buf.Reset()
+	output.SetColorMode(xlog.ColorAuto)
+	_, _, line, _ = runtime.Caller(0)
+	logger.Warning("not a terminal.")
+	want = fmt.Sprintf("WARNING - console_test.go:%d - not a terminal.\n", line+1)
+	if got := buf.String(); got != want {
+		t.Errorf("auto colored output %q, want %q", got, want)
+	}
+}
+
+func TestNewConsoleOutput(t *testing.T) {
+	var buf bytes.Buffer
+	output := xlog.NewConsoleOutput(&buf).SetFlags(xlog.FlagSeverity | xlog.FlagFields)
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	logger.WithFieldKeyVals("key", "value", "long_key", 2).Info("aligned fields.")
+	want := "INFO - aligned fields.\n\t\n\t+ \"key\"      = \"value\"\n\t+ \"long_key\" = \"2\"\n\t\n"
+	if got := buf.String(); got != want {
+		t.Errorf("console output\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DedupOutput is an implementation of Output that collapses the consecutive identical logs like syslogd.
+// The logs are identical if they have the same message, severity, StackCaller location and fields.
+// DedupOutput passes the first one of the identical logs, suppresses the rest of them during the window, and then
+// passes a single "last message repeated N times" Log which has the field "repeated". The window starts at the time
+// of the passed Log, an identical Log whose time is out of the window is passed as a new one.
+type DedupOutput struct {
+	mu       sync.Mutex
+	output   Output
+	window   time.Duration
+	last     *Log
+	repeated int
+	timer    *time.Timer
+	timerGen uint64
+	closed   bool
+}
+
+// NewDedupOutput creates a new DedupOutput by the given output and window.
+func NewDedupOutput(output Output, window time.Duration) *DedupOutput {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &DedupOutput{
+		output: output,
+		window: window,
+	}
+}
+
+// Close closes DedupOutput and the underlying output after passing the pending repeat summary if there is.
+func (d *DedupOutput) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	summary := d.reset()
+	d.mu.Unlock()
+	if summary != nil {
+		d.output.Log(summary)
+	}
+	return closeOutput(d.output)
+}
+
+// Flush is implementation of Flusher.
+// It passes the pending repeat summary if there is, and then flushes the underlying output.
+func (d *DedupOutput) Flush(ctx context.Context) error {
+	d.flush()
+	return flushOutput(ctx, d.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (d *DedupOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(d.output, f)
+}
+
+// Log is implementation of Output.
+func (d *DedupOutput) Log(log *Log) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		log.Release()
+		return
+	}
+	if d.last != nil && log.Time.Sub(d.last.Time) <= d.window && isLogIdentical(d.last, log) {
+		d.repeated++
+		if d.timer == nil {
+			gen := d.timerGen
+			d.timer = time.AfterFunc(d.window, func() {
+				d.expire(gen)
+			})
+		}
+		d.mu.Unlock()
+		log.Release()
+		return
+	}
+	summary := d.reset()
+	log.retain(1)
+	d.last = log
+	d.mu.Unlock()
+	if summary != nil {
+		d.output.Log(summary)
+	}
+	d.output.Log(log)
+}
+
+// expire passes the pending repeat summary when the window of the timer of the given generation has expired.
+// It does nothing if the timer has been stopped after it fired.
+func (d *DedupOutput) expire(gen uint64) {
+	d.mu.Lock()
+	if gen != d.timerGen {
+		d.mu.Unlock()
+		return
+	}
+	summary := d.reset()
+	d.mu.Unlock()
+	if summary != nil {
+		d.output.Log(summary)
+	}
+}
+
+// flush passes the pending repeat summary if there is.
+func (d *DedupOutput) flush() {
+	d.mu.Lock()
+	summary := d.reset()
+	d.mu.Unlock()
+	if summary != nil {
+		d.output.Log(summary)
+	}
+}
+
+// reset forgets the last Log, and returns the repeat summary Log if there is.
+func (d *DedupOutput) reset() (summary *Log) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+		d.timerGen++
+	}
+	if d.last == nil {
+		return nil
+	}
+	if d.repeated > 0 {
+		summary = newLog()
+		summary.Message = append(summary.Message, "last message repeated "...)
+		summary.Message = strconv.AppendInt(summary.Message, int64(d.repeated), 10)
+		if d.repeated == 1 {
+			summary.Message = append(summary.Message, " time"...)
+		} else {
+			summary.Message = append(summary.Message, " times"...)
+		}
+		summary.Severity = d.last.Severity
+		summary.Verbosity = d.last.Verbosity
+		summary.Time = time.Now()
+		summary.Fields = append(summary.Fields, Field{Key: "repeated", Value: d.repeated})
+		summary.StackCaller = d.last.StackCaller
+		summary.Flags = d.last.Flags
+	}
+	d.last.Release()
+	d.last = nil
+	d.repeated = 0
+	return summary
+}
+
+// isLogIdentical returns whether the logs have the same message, severity, StackCaller location and fields.
+func isLogIdentical(a, b *Log) bool {
+	if a.Severity != b.Severity || !bytes.Equal(a.Message, b.Message) || len(a.Fields) != len(b.Fields) ||
+		a.StackCaller.File != b.StackCaller.File || a.StackCaller.Line != b.StackCaller.Line ||
+		a.StackCaller.Function != b.StackCaller.Function {
+		return false
+	}
+	if len(a.Fields) == 0 {
+		return true
+	}
+	bufA, bufB := getBuffer(), getBuffer()
+	defer putBuffer(bufA)
+	defer putBuffer(bufB)
+	for i := range a.Fields {
+		if a.Fields[i].Key != b.Fields[i].Key {
+			return false
+		}
+		bufA.b = appendValue(bufA.b[:0], a.Fields[i].Value)
+		bufB.b = appendValue(bufB.b[:0], b.Fields[i].Value)
+		if !bytes.Equal(bufA.b, bufB.b) {
+			return false
+		}
+	}
+	return true
+}
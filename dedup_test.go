@@ -0,0 +1,75 @@
+package xlog_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleDedupOutput() {
+	dedup := xlog.NewDedupOutput(xlog.NewTextOutput(os.Stdout), time.Hour)
+	logger := xlog.New(dedup, xlog.SeverityInfo, 0)
+	logger.SetFlags(xlog.FlagSeverity)
+
+	for i := 0; i < 5; i++ {
+		logger.Warning("connection refused, retrying.")
+	}
+	logger.Info("connected.")
+	for i := 0; i < 3; i++ {
+		logger.Info("heartbeat.")
+	}
+	_ = dedup.Close()
+
+	// Output:
+	// WARNING - connection refused, retrying.
+	// WARNING - last message repeated 4 times
+	// INFO - connected.
+	// INFO - heartbeat.
+	// INFO - last message repeated 2 times
+}
+
+func TestDedupOutput_window(t *testing.T) {
+	output := &recordOutput{}
+	dedup := xlog.NewDedupOutput(output, time.Minute)
+	tm := time.Date(2010, 11, 12, 13, 14, 15, 0, time.UTC)
+
+	for _, d := range []time.Duration{0, 30 * time.Second, time.Minute, 2 * time.Minute, 3 * time.Hour} {
+		dedup.Log(&xlog.Log{Message: []byte("disk full"), Severity: xlog.SeverityError, Time: tm.Add(d)})
+	}
+	_ = dedup.Close()
+
+	want := []string{
+		"disk full",
+		"last message repeated 2 times",
+		"disk full",
+		"disk full",
+	}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDedupOutput_fields(t *testing.T) {
+	output := &recordOutput{}
+	dedup := xlog.NewDedupOutput(output, time.Hour)
+	logger := xlog.New(dedup, xlog.SeverityInfo, 0)
+
+	for _, user := range []string{"alice", "alice", "bob", "bob", "alice"} {
+		logger.WithFieldKeyVals("user", user).Info("login")
+	}
+	_ = dedup.Close()
+
+	want := []string{
+		"login",
+		"last message repeated 1 time",
+		"login",
+		"last message repeated 1 time",
+		"login",
+	}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package xlog
+
+import (
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// EscapeMode defines how the text-based Outputs escape the user controlled texts like the messages, the error texts
+// and the field values, in order to prevent log injection.
+type EscapeMode int
+
+const (
+	// EscapeNone writes the texts verbatim
+	EscapeNone EscapeMode = iota
+
+	// EscapeControl escapes the control characters except newline and tab, so carriage returns and terminal escape
+	// sequences are neutralized. Multi-line messages are still written in multiple lines.
+	EscapeControl
+
+	// EscapeStrict escapes all the control characters including newline and tab, the backslash, the non-printable
+	// characters like bidirectional overrides and the invalid UTF-8 bytes. Every Log is written in a single line
+	// apart from the extensions like fields and stack traces.
+	EscapeStrict
+)
+
+const escapeHex = "0123456789abcdef"
+
+// appendEscaped appends s to b by escaping by the mode.
+func appendEscaped(b []byte, s string, mode EscapeMode) []byte {
+	if mode == EscapeNone {
+		return append(b, s...)
+	}
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if !needsEscape(c, mode) {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			b = appendEscapedByte(b, c)
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			if mode != EscapeStrict {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'x', escapeHex[c>>4], escapeHex[c&0xf])
+		case 0x80 <= r && r <= 0x9f, mode == EscapeStrict && !unicode.IsPrint(r):
+			b = append(b, s[start:i]...)
+			b = appendEscapedRune(b, r)
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	return append(b, s[start:]...)
+}
+
+// appendEscapedBytes is like appendEscaped for the byte slice.
+func appendEscapedBytes(b []byte, s []byte, mode EscapeMode) []byte {
+	return appendEscaped(b, *(*string)(unsafe.Pointer(&s)), mode)
+}
+
+// needsEscape returns whether the ASCII character c is escaped by the mode.
+func needsEscape(c byte, mode EscapeMode) bool {
+	switch {
+	case c == '\n' || c == '\t':
+		return mode == EscapeStrict
+	case c == '\\':
+		return mode == EscapeStrict
+	default:
+		return c < 0x20 || c == 0x7f
+	}
+}
+
+func appendEscapedByte(b []byte, c byte) []byte {
+	switch c {
+	case '\n':
+		return append(b, '\\', 'n')
+	case '\r':
+		return append(b, '\\', 'r')
+	case '\t':
+		return append(b, '\\', 't')
+	case '\\':
+		return append(b, '\\', '\\')
+	default:
+		return append(b, '\\', 'x', escapeHex[c>>4], escapeHex[c&0xf])
+	}
+}
+
+func appendEscapedRune(b []byte, r rune) []byte {
+	if r > 0xffff {
+		b = append(b, '\\', 'U')
+		for shift := uint(28); ; shift -= 4 {
+			b = append(b, escapeHex[(r>>shift)&0xf])
+			if shift == 0 {
+				return b
+			}
+		}
+	}
+	b = append(b, '\\', 'u')
+	for shift := uint(12); ; shift -= 4 {
+		b = append(b, escapeHex[(r>>shift)&0xf])
+		if shift == 0 {
+			return b
+		}
+	}
+}
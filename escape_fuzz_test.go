@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+package xlog_test
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/goinsane/xlog"
+)
+
+func FuzzLog_MarshalText(f *testing.F) {
+	f.Add("message", "key", "value")
+	f.Add("multi\nline\nmessage", "", "")
+	f.Add("\x1b[2J\x1b[H\rINFO - forged", "k\x00", "v\r\n")
+	f.Add("‮ \xff\xfe", "\\", "\t")
+	f.Fuzz(func(t *testing.T, message, key, value string) {
+		log := &xlog.Log{
+			Message:  []byte(message),
+			Severity: xlog.SeverityInfo,
+			Fields:   xlog.Fields{{Key: key, Value: value}},
+			Flags:    xlog.FlagDefault,
+		}
+		if _, err := log.MarshalText(); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		output := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity | xlog.FlagFields).SetEscapeMode(xlog.EscapeStrict)
+		if err := output.TryLog(log); err != nil {
+			t.Fatal(err)
+		}
+		line, rest := buf.Bytes(), []byte(nil)
+		if idx := bytes.IndexByte(line, '\n'); idx >= 0 {
+			line, rest = line[:idx], line[idx+1:]
+		}
+		if !utf8.Valid(line) {
+			t.Errorf("invalid UTF-8 in strict mode: %q", line)
+		}
+		for _, c := range line {
+			if c < 0x20 || c == 0x7f {
+				t.Errorf("control character %#x in strict mode: %q", c, line)
+			}
+		}
+		for _, c := range rest {
+			if c == '\r' || c == 0x1b {
+				t.Errorf("control character %#x in the fields in strict mode: %q", c, rest)
+			}
+		}
+
+		buf.Reset()
+		output.SetEscapeMode(xlog.EscapeControl)
+		if err := output.TryLog(log); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.IndexByte(buf.Bytes(), '\r') >= 0 || bytes.IndexByte(buf.Bytes(), 0x1b) >= 0 {
+			t.Errorf("control character in control mode: %q", buf.Bytes())
+		}
+	})
+}
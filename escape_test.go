@@ -0,0 +1,41 @@
+package xlog_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestTextOutput_SetEscapeMode(t *testing.T) {
+	message := "user \x1b[31mroot\x1b[0m logged in\r\nINFO - forged\t\u202ecod.exe \\ \xff"
+	for _, test := range []struct {
+		mode xlog.EscapeMode
+		want string
+	}{
+		{xlog.EscapeNone, "INFO - user \x1b[31mroot\x1b[0m logged in\r\n       INFO - forged\t\u202ecod.exe \\ \xff\n"},
+		{xlog.EscapeControl, "INFO - user \\x1b[31mroot\\x1b[0m logged in\\r\n       INFO - forged\t\u202ecod.exe \\ \xff\n"},
+		{xlog.EscapeStrict, "INFO - user \\x1b[31mroot\\x1b[0m logged in\\r\\nINFO - forged\\t\\u202ecod.exe \\\\ \\xff\n"},
+	} {
+		var buf bytes.Buffer
+		output := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity | xlog.FlagPadding).SetEscapeMode(test.mode)
+		logger := xlog.New(output, xlog.SeverityInfo, 0)
+		logger.Info(message)
+		if got := buf.String(); got != test.want {
+			t.Errorf("mode %d:\n%q\nwant\n%q", test.mode, got, test.want)
+		}
+	}
+}
+
+func TestLayout_escape(t *testing.T) {
+	var buf bytes.Buffer
+	output := xlog.NewTextOutput(&buf).SetEscapeMode(xlog.EscapeStrict)
+	output.SetLayout(xlog.MustParseLayout(`%level %msg error=%error user=%field{user}`))
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger.WithFieldKeyVals("user", "x\ny").Errorf("login\nfailed: %w", errors.New("bad\rinput"))
+	want := "ERROR login\\nfailed: bad\\rinput error=bad\\rinput user=x\\ny\n"
+	if got := buf.String(); got != want {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
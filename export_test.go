@@ -0,0 +1,12 @@
+package xlog
+
+import "time"
+
+// SetClock sets the functions which RateLimitOutput uses instead of time.Now and time.Sleep.
+func (r *RateLimitOutput) SetClock(now func() time.Time, sleep func(d time.Duration)) *RateLimitOutput {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+	r.sleep = sleep
+	return r
+}
@@ -0,0 +1,92 @@
+package xlog_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goinsane/erf"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestLogger_Fatal(t *testing.T) {
+	var buf bytes.Buffer
+	queued := xlog.NewQueuedOutput(xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity), 16)
+	code := -1
+	logger := xlog.New(queued, xlog.SeverityInfo, 0).
+		SetFatalTimeout(time.Second).
+		SetExitFunc(func(c int) {
+			code = c
+		})
+
+	logger.Fatal("this is fatal log.")
+	if code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if got, want := buf.String(), "FATAL - this is fatal log.\n"; got != want {
+		t.Errorf("output %q, want %q", got, want)
+	}
+}
+
+func TestLogger_Panic(t *testing.T) {
+	var log *xlog.Log
+	logger := xlog.New(&lastLogOutput{log: &log}, xlog.SeverityInfo, 0)
+
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		logger.Panicf("this is panic log: %w", erf.New("panic error"))
+	}()
+
+	e, ok := recovered.(*erf.Erf)
+	if !ok {
+		t.Fatalf("recovered %T, want *erf.Erf", recovered)
+	}
+	if got, want := e.Error(), "this is panic log: panic error"; got != want {
+		t.Errorf("error %q, want %q", got, want)
+	}
+	if log == nil {
+		t.Fatal("no log")
+	}
+	if log.Severity != xlog.SeverityPanic {
+		t.Errorf("severity %v, want %v", log.Severity, xlog.SeverityPanic)
+	}
+	if got := filepath.Base(log.StackCaller.File); got != "fatal_test.go" {
+		t.Errorf("caller file %q, want %q", got, "fatal_test.go")
+	}
+}
+
+func TestSeverityPanic(t *testing.T) {
+	for i, s := range []xlog.Severity{xlog.SeverityNone, xlog.SeverityFatal, xlog.SeverityError,
+		xlog.SeverityWarning, xlog.SeverityInfo, xlog.SeverityDebug} {
+		if int(s) != i {
+			t.Errorf("severity %v is %d, want %d", s, int(s), i)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger := xlog.New(xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity), xlog.SeverityPanic, 0)
+	logger.Error("this is error log. but it won't be shown.")
+	func() {
+		defer func() {
+			_ = recover()
+		}()
+		logger.Panic("this is panic log.")
+	}()
+	if got, want := buf.String(), "PANIC - this is panic log.\n"; got != want {
+		t.Errorf("output %q, want %q", got, want)
+	}
+}
+
+// lastLogOutput keeps the last log.
+type lastLogOutput struct {
+	log **xlog.Log
+}
+
+func (o *lastLogOutput) Log(log *xlog.Log) {
+	*o.log = log
+}
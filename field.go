@@ -2,6 +2,7 @@ package xlog
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -47,6 +48,14 @@ func (f Fields) Swap(i, j int) {
 	f[i], f[j] = f[j], f[i]
 }
 
+// appendKey appends the mark and the quoted key of the Field to b.
+func (f *Field) appendKey(b []byte) []byte {
+	if f.mark != nil {
+		b = append(b, fmt.Sprintf("%v", f.mark)...)
+	}
+	return strconv.AppendQuote(b, f.Key)
+}
+
 type FieldMarkErf struct {
 	No    int
 	Index int
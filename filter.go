@@ -0,0 +1,510 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPredicate = errors.New("invalid predicate")
+)
+
+// Predicate reports whether the given Log matches. A Predicate must not modify or keep the Log.
+type Predicate func(log *Log) bool
+
+type filterOutput struct {
+	output    Output
+	predicate Predicate
+}
+
+func (f *filterOutput) Log(log *Log) {
+	if f.predicate != nil && !f.predicate(log) {
+		log.Release()
+		return
+	}
+	f.output.Log(log)
+}
+
+// Flush is implementation of Flusher.
+func (f *filterOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, f.output)
+}
+
+// Close is implementation of Closer.
+func (f *filterOutput) Close() error {
+	return closeOutput(f.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (f *filterOutput) SetErrorReporter(fn func(error)) {
+	setErrorReporter(f.output, fn)
+}
+
+// FilterOutput creates an output that passes only the logs matched by predicate to the provided output.
+// If predicate is nil, it passes all the logs.
+func FilterOutput(output Output, predicate Predicate) Output {
+	return &filterOutput{
+		output:    output,
+		predicate: predicate,
+	}
+}
+
+// ParsePredicate parses a predicate expression and returns the Predicate.
+//
+// An expression consists of conditions combined by the operators "&&" (also "and"), "||" (also "or"), "!" (also
+// "not") and parentheses. A condition is either a subject alone which checks presence, or a subject compared to a
+// value.
+//
+// Subjects:
+//
+//	severity          the severity of the Log, compared by the severity order: "severity <= ERROR" matches ERROR, PANIC and FATAL
+//	verbosity         the verbosity of the Log
+//	message           the message of the Log
+//	error             the error text of the Log, alone it checks error presence
+//	field.<key>       the value of the last field which has the key, alone it checks field presence
+//	caller.file       the file of the StackCaller of the Log
+//	caller.line       the line of the StackCaller of the Log
+//	caller.func       the full function name of the StackCaller of the Log: a/b/c/d.Func1
+//	caller.package    the package path of the StackCaller of the Log: a/b/c/d
+//
+// Operators:
+//
+//	== !=             equality
+//	< <= > >=         ordering, numeric if both sides are numbers
+//	contains          substring match
+//	~ !~              regular expression match
+//
+// Values are either double-quoted Go strings or bare words like ERROR, 3 or true.
+//
+// For example:
+//
+//	severity <= ERROR
+//	field.audit == true
+//	!(caller.package == "github.com/foo/noisy") && message contains "timeout"
+func ParsePredicate(expr string) (Predicate, error) {
+	p := &predicateParser{
+		expr: expr,
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	predicate, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != predicateTokenEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return predicate, nil
+}
+
+// MustParsePredicate is like ParsePredicate, but panics if the expression cannot be parsed.
+func MustParsePredicate(expr string) Predicate {
+	predicate, err := ParsePredicate(expr)
+	if err != nil {
+		panic(err)
+	}
+	return predicate
+}
+
+type predicateTokenKind int
+
+const (
+	predicateTokenEOF predicateTokenKind = iota
+	predicateTokenWord
+	predicateTokenString
+	predicateTokenOperator
+)
+
+type predicateToken struct {
+	kind predicateTokenKind
+	text string
+	pos  int
+}
+
+type predicateParser struct {
+	expr string
+	pos  int
+	tok  predicateToken
+}
+
+func (p *predicateParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrInvalidPredicate, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *predicateParser) next() error {
+	for p.pos < len(p.expr) && strings.IndexByte(" \t\r\n", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	p.tok = predicateToken{
+		pos: p.pos,
+	}
+	if p.pos >= len(p.expr) {
+		p.tok.kind = predicateTokenEOF
+		return nil
+	}
+	s := p.expr[p.pos:]
+	switch c := s[0]; {
+	case c == '"':
+		n := 1
+		for ; n < len(s); n++ {
+			if s[n] == '\\' {
+				n++
+				continue
+			}
+			if s[n] == '"' {
+				break
+			}
+		}
+		if n >= len(s) {
+			return p.errorf("unterminated string")
+		}
+		text, err := strconv.Unquote(s[:n+1])
+		if err != nil {
+			return p.errorf("invalid string %s", s[:n+1])
+		}
+		p.tok.kind, p.tok.text = predicateTokenString, text
+		p.pos += n + 1
+		return nil
+	case isPredicateWordChar(c):
+		n := 1
+		for n < len(s) && isPredicateWordChar(s[n]) {
+			n++
+		}
+		p.tok.kind, p.tok.text = predicateTokenWord, s[:n]
+		p.pos += n
+		return nil
+	}
+	for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!", "(", ")"} {
+		if strings.HasPrefix(s, op) {
+			p.tok.kind, p.tok.text = predicateTokenOperator, op
+			p.pos += len(op)
+			return nil
+		}
+	}
+	return p.errorf("unexpected character %q", s[0])
+}
+
+func isPredicateWordChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == '+' || c == '/'
+}
+
+func (p *predicateParser) isOperator(ops ...string) bool {
+	for _, op := range ops {
+		if (p.tok.kind == predicateTokenOperator || p.tok.kind == predicateTokenWord) && p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *predicateParser) parseOr() (Predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||", "or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateOr(left, right)
+	}
+	return left, nil
+}
+
+func (p *predicateParser) parseAnd() (Predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&", "and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateAnd(left, right)
+	}
+	return left, nil
+}
+
+func (p *predicateParser) parseUnary() (Predicate, error) {
+	if p.isOperator("!", "not") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		predicate, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(log *Log) bool {
+			return !predicate(log)
+		}, nil
+	}
+	if p.isOperator("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		predicate, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(")") {
+			return nil, p.errorf("expected %q", ")")
+		}
+		return predicate, p.next()
+	}
+	return p.parseCondition()
+}
+
+func (p *predicateParser) parseCondition() (Predicate, error) {
+	if p.tok.kind != predicateTokenWord {
+		return nil, p.errorf("expected subject")
+	}
+	subject := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if !p.isOperator("==", "!=", "<", "<=", ">", ">=", "~", "!~", "contains") {
+		return newPresencePredicate(subject, p)
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != predicateTokenWord && p.tok.kind != predicateTokenString {
+		return nil, p.errorf("expected value")
+	}
+	value := p.tok.text
+	predicate, err := newComparisonPredicate(subject, op, value, p)
+	if err != nil {
+		return nil, err
+	}
+	return predicate, p.next()
+}
+
+func predicateAnd(left, right Predicate) Predicate {
+	return func(log *Log) bool {
+		return left(log) && right(log)
+	}
+}
+
+func predicateOr(left, right Predicate) Predicate {
+	return func(log *Log) bool {
+		return left(log) || right(log)
+	}
+}
+
+func newPresencePredicate(subject string, p *predicateParser) (Predicate, error) {
+	switch {
+	case subject == "error":
+		return func(log *Log) bool {
+			return log.Error != nil
+		}, nil
+	case strings.HasPrefix(subject, "field."):
+		key := strings.TrimPrefix(subject, "field.")
+		return func(log *Log) bool {
+			_, ok := lookupField(log.Fields, key)
+			return ok
+		}, nil
+	}
+	return nil, p.errorf("expected operator after %q", subject)
+}
+
+func newComparisonPredicate(subject string, op string, value string, p *predicateParser) (Predicate, error) {
+	var re *regexp.Regexp
+	if op == "~" || op == "!~" {
+		var err error
+		re, err = regexp.Compile(value)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+	}
+
+	switch subject {
+	case "severity":
+		var severity Severity
+		if err := severity.UnmarshalText([]byte(value)); err != nil {
+			n, e := strconv.Atoi(value)
+			if e != nil {
+				return nil, p.errorf("%v: %s", err, value)
+			}
+			severity = Severity(n)
+		}
+		return newIntPredicate(op, int64(severity.rank()), func(log *Log) int64 {
+			return int64(log.Severity.rank())
+		}, p)
+
+	case "verbosity", "caller.line":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", value)
+		}
+		if subject == "verbosity" {
+			return newIntPredicate(op, n, func(log *Log) int64 {
+				return int64(log.Verbosity)
+			}, p)
+		}
+		return newIntPredicate(op, n, func(log *Log) int64 {
+			return int64(log.StackCaller.Line)
+		}, p)
+	}
+
+	var get func(log *Log, b []byte) ([]byte, bool)
+	switch {
+	case subject == "message":
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			return log.Message, true
+		}
+	case subject == "error":
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			if log.Error == nil {
+				return nil, false
+			}
+			return append(b, log.ErrorText()...), true
+		}
+	case subject == "caller.file":
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			return append(b, log.StackCaller.File...), true
+		}
+	case subject == "caller.func":
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			return append(b, log.StackCaller.Function...), true
+		}
+	case subject == "caller.package":
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			return append(b, funcPackage(log.StackCaller.Function)...), true
+		}
+	case strings.HasPrefix(subject, "field."):
+		key := strings.TrimPrefix(subject, "field.")
+		get = func(log *Log, b []byte) ([]byte, bool) {
+			field, ok := lookupField(log.Fields, key)
+			if !ok {
+				return nil, false
+			}
+			return appendValue(b, field.Value), true
+		}
+	default:
+		return nil, p.errorf("unknown subject %q", subject)
+	}
+
+	var match func(s []byte) bool
+	switch op {
+	case "==":
+		match = func(s []byte) bool {
+			return string(s) == value
+		}
+	case "!=":
+		match = func(s []byte) bool {
+			return string(s) != value
+		}
+	case "contains":
+		sub := []byte(value)
+		match = func(s []byte) bool {
+			return bytes.Contains(s, sub)
+		}
+	case "~":
+		match = re.Match
+	case "!~":
+		match = func(s []byte) bool {
+			return !re.Match(s)
+		}
+	default:
+		match = func(s []byte) bool {
+			return compareOrdered(op, compareValues(s, value))
+		}
+	}
+
+	return func(log *Log) bool {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		s, ok := get(log, buf.b)
+		if !ok {
+			return op == "!=" || op == "!~"
+		}
+		return match(s)
+	}, nil
+}
+
+func newIntPredicate(op string, value int64, get func(log *Log) int64, p *predicateParser) (Predicate, error) {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, p.errorf("invalid operator %q for number", op)
+	}
+	return func(log *Log) bool {
+		n, c := get(log), 0
+		if n < value {
+			c = -1
+		} else if n > value {
+			c = 1
+		}
+		return compareOrdered(op, c)
+	}, nil
+}
+
+// compareValues compares a and b numerically if both of them are numbers, otherwise lexically.
+func compareValues(a []byte, b string) int {
+	if x, err := strconv.ParseFloat(string(a), 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(string(a), b)
+}
+
+func compareOrdered(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// lookupField returns the last field which has the given key.
+func lookupField(fields Fields, key string) (*Field, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == key {
+			return &fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// funcPackage returns the package path of the full function name.
+func funcPackage(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
@@ -0,0 +1,110 @@
+package xlog_test
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/goinsane/erf"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestParsePredicate(t *testing.T) {
+	log := &xlog.Log{
+		Message:   []byte("connection timeout"),
+		Error:     errors.New("dial tcp: i/o timeout"),
+		Severity:  xlog.SeverityError,
+		Verbosity: 2,
+		Fields: xlog.Fields{
+			{Key: "audit", Value: true},
+			{Key: "tenant", Value: "acme"},
+			{Key: "count", Value: 10},
+		},
+		StackCaller: erf.StackCaller{
+			Frame: runtime.Frame{
+				Function: "github.com/foo/bar/noisy.(*Client).Dial",
+				File:     "/src/github.com/foo/bar/noisy/client.go",
+				Line:     42,
+			},
+		},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`severity <= ERROR`, true},
+		{`severity <= WARNING`, true},
+		{`severity < ERROR`, false},
+		{`severity == err`, true},
+		{`verbosity >= 2`, true},
+		{`verbosity > 2`, false},
+		{`message contains "timeout"`, true},
+		{`message ~ "^conn.*out$"`, true},
+		{`message !~ "refused"`, true},
+		{`message == "connection timeout"`, true},
+		{`error`, true},
+		{`!error`, false},
+		{`error contains "i/o"`, true},
+		{`field.audit == true`, true},
+		{`field.audit`, true},
+		{`field.missing`, false},
+		{`field.missing != x`, true},
+		{`field.tenant == "acme" && severity <= ERROR`, true},
+		{`field.count > 9`, true},
+		{`field.count < 9`, false},
+		{`caller.line == 42`, true},
+		{`caller.file ~ "noisy/"`, true},
+		{`caller.func contains "Dial"`, true},
+		{`caller.package == github.com/foo/bar/noisy`, true},
+		{`!(caller.package == "github.com/foo/bar/noisy")`, false},
+		{`not field.audit or severity == FATAL`, false},
+		{`field.audit and (severity == FATAL || verbosity == 2)`, true},
+	}
+	for _, test := range tests {
+		predicate, err := xlog.ParsePredicate(test.expr)
+		if err != nil {
+			t.Errorf("ParsePredicate(%q) error: %v", test.expr, err)
+			continue
+		}
+		if got := predicate(log); got != test.want {
+			t.Errorf("ParsePredicate(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestParsePredicate_invalid(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`severity <=`,
+		`severity <= UNKNOWN`,
+		`message contains`,
+		`message ~ "("`,
+		`(severity == ERROR`,
+		`severity == ERROR)`,
+		`unknown == 1`,
+		`message`,
+		`verbosity contains 1`,
+		`message == "unterminated`,
+		`message == $`,
+	} {
+		if _, err := xlog.ParsePredicate(expr); !errors.Is(err, xlog.ErrInvalidPredicate) {
+			t.Errorf("ParsePredicate(%q) error = %v, want %v", expr, err, xlog.ErrInvalidPredicate)
+		}
+	}
+}
+
+func ExampleFilterOutput() {
+	output := xlog.FilterOutput(xlog.NewTextOutput(os.Stdout), xlog.MustParsePredicate(`severity <= WARNING || field.audit == true`))
+	logger := xlog.New(output, xlog.SeverityDebug, 0)
+	logger.SetFlags(xlog.FlagSeverity)
+
+	logger.Info("this is info log. it won't be shown.")
+	logger.Warning("this is warning log.")
+	logger.WithFieldKeyVals("audit", true).Info("this is info log with audit field.")
+
+	// Output:
+	// WARNING - this is warning log.
+	// INFO - this is info log with audit field.
+}
@@ -0,0 +1,225 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FingersCrossedOutput is an implementation of Output that keeps the logs in memory per scope, and writes them to the
+// given output only if something goes wrong. Every scope buffers its last logs, and flushes the whole buffer to the
+// output when a Log at or above the trigger severity arrives. After that, the scope passes its logs directly. The
+// buffer is discarded when the scope ends.
+//
+// The scopes are created either explicitly by Scope for a Logger clone, or implicitly by the key of the logs given to
+// FingersCrossedOutput's Log method, e.g. a request id field. The implicit scopes end by EndScope, or when they are
+// idle during the idle timeout, or when they are the least recently used ones and the number of the implicit scopes
+// exceeds the maximum. See SetScopeLimits.
+type FingersCrossedOutput struct {
+	mu          sync.Mutex
+	output      Output
+	bufferLen   int
+	trigger     Severity
+	keyFunc     KeyFunc
+	scopes      map[string]*FingersCrossedScope
+	maxScopes   int
+	idleTimeout time.Duration
+}
+
+// NewFingersCrossedOutput creates a new FingersCrossedOutput by the given output. The argument bufferLen is the
+// maximum number of the logs kept per scope. The argument keyFunc defines the scopes of the logs given to
+// FingersCrossedOutput's Log method, if it is nil all of them share a single scope.
+func NewFingersCrossedOutput(output Output, bufferLen int, trigger Severity, keyFunc KeyFunc) *FingersCrossedOutput {
+	if bufferLen < 0 {
+		bufferLen = 0
+	}
+	return &FingersCrossedOutput{
+		output:      output,
+		bufferLen:   bufferLen,
+		trigger:     trigger,
+		keyFunc:     keyFunc,
+		scopes:      make(map[string]*FingersCrossedScope),
+		maxScopes:   1024,
+		idleTimeout: time.Minute,
+	}
+}
+
+// SetScopeLimits sets the maximum number of the implicit scopes and the idle timeout of them. The buffers of the
+// ended scopes are discarded. If maxScopes or idleTimeout is 0 or less, it is unlimited.
+// It returns underlying FingersCrossedOutput.
+// By default, 1024 scopes and 1m.
+func (f *FingersCrossedOutput) SetScopeLimits(maxScopes int, idleTimeout time.Duration) *FingersCrossedOutput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxScopes = maxScopes
+	f.idleTimeout = idleTimeout
+	return f
+}
+
+// Log is implementation of Output.
+// It buffers the log in the scope of the key of the log.
+func (f *FingersCrossedOutput) Log(log *Log) {
+	var key string
+	if f.keyFunc != nil {
+		key = f.keyFunc(log)
+	}
+	now := time.Now()
+	f.mu.Lock()
+	scope := f.scopes[key]
+	var ended []*FingersCrossedScope
+	if scope == nil {
+		ended = f.evictScopes(now)
+		scope = f.Scope()
+		f.scopes[key] = scope
+	}
+	scope.lastUsed = now
+	f.mu.Unlock()
+	for _, s := range ended {
+		_ = s.Close()
+	}
+	scope.Log(log)
+}
+
+// evictScopes removes the idle implicit scopes and the least recently used one if there is no room for a new scope,
+// and returns the removed scopes to close.
+func (f *FingersCrossedOutput) evictScopes(now time.Time) (ended []*FingersCrossedScope) {
+	if f.idleTimeout > 0 {
+		for key, scope := range f.scopes {
+			if now.Sub(scope.lastUsed) > f.idleTimeout {
+				delete(f.scopes, key)
+				ended = append(ended, scope)
+			}
+		}
+	}
+	if f.maxScopes > 0 {
+		for len(f.scopes) >= f.maxScopes {
+			var lruKey string
+			var lru *FingersCrossedScope
+			for key, scope := range f.scopes {
+				if lru == nil || scope.lastUsed.Before(lru.lastUsed) {
+					lruKey, lru = key, scope
+				}
+			}
+			delete(f.scopes, lruKey)
+			ended = append(ended, lru)
+		}
+	}
+	return ended
+}
+
+// Scope creates a new scope. The returned FingersCrossedScope is an Output to set to a Logger clone, and must be
+// closed when the scope ends.
+func (f *FingersCrossedOutput) Scope() *FingersCrossedScope {
+	return &FingersCrossedScope{
+		parent: f,
+		buffer: make([]*Log, 0, f.bufferLen),
+	}
+}
+
+// WithScope duplicates the given Logger with a new scope, and returns the new Logger and the scope.
+// The scope must be closed when it ends.
+func (f *FingersCrossedOutput) WithScope(logger *Logger) (*Logger, *FingersCrossedScope) {
+	scope := f.Scope()
+	return logger.Duplicate().SetOutput(scope), scope
+}
+
+// EndScope ends the scope of the given key, and discards its buffer.
+func (f *FingersCrossedOutput) EndScope(key string) {
+	f.mu.Lock()
+	scope := f.scopes[key]
+	delete(f.scopes, key)
+	f.mu.Unlock()
+	if scope != nil {
+		_ = scope.Close()
+	}
+}
+
+// Flush is implementation of Flusher.
+// It flushes the underlying output, the buffers of the scopes which aren't triggered are kept.
+func (f *FingersCrossedOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, f.output)
+}
+
+// Close is implementation of Closer.
+// It ends all the scopes of the keys, and closes the underlying output.
+func (f *FingersCrossedOutput) Close() error {
+	f.mu.Lock()
+	scopes := f.scopes
+	f.scopes = make(map[string]*FingersCrossedScope)
+	f.mu.Unlock()
+	for _, scope := range scopes {
+		_ = scope.Close()
+	}
+	return closeOutput(f.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (f *FingersCrossedOutput) SetErrorReporter(fn func(error)) {
+	setErrorReporter(f.output, fn)
+}
+
+// FingersCrossedScope is a scope of FingersCrossedOutput.
+type FingersCrossedScope struct {
+	mu        sync.Mutex
+	parent    *FingersCrossedOutput
+	buffer    []*Log
+	start     int
+	triggered bool
+	closed    bool
+	lastUsed  time.Time // accessed under the lock of the parent for the implicit scopes
+}
+
+// Log is implementation of Output.
+func (s *FingersCrossedScope) Log(log *Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		log.Release()
+		return
+	}
+	if s.triggered {
+		s.parent.output.Log(log)
+		return
+	}
+	if log.Severity != SeverityNone && log.Severity.rank() <= s.parent.trigger.rank() {
+		s.triggered = true
+		for i := range s.buffer {
+			idx := (s.start + i) % len(s.buffer)
+			s.parent.output.Log(s.buffer[idx])
+			s.buffer[idx] = nil
+		}
+		s.buffer, s.start = nil, 0
+		s.parent.output.Log(log)
+		return
+	}
+	if s.parent.bufferLen <= 0 {
+		log.Release()
+		return
+	}
+	if len(s.buffer) < s.parent.bufferLen {
+		s.buffer = append(s.buffer, log)
+		return
+	}
+	s.buffer[s.start].Release()
+	s.buffer[s.start] = log
+	s.start = (s.start + 1) % len(s.buffer)
+}
+
+// IsTriggered returns whether the scope has been triggered.
+func (s *FingersCrossedScope) IsTriggered() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.triggered
+}
+
+// Close ends the scope, and discards its buffer.
+func (s *FingersCrossedScope) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, log := range s.buffer {
+		log.Release()
+	}
+	s.buffer, s.start = nil, 0
+	return nil
+}
@@ -0,0 +1,131 @@
+package xlog_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleFingersCrossedOutput() {
+	fingersCrossed := xlog.NewFingersCrossedOutput(xlog.NewTextOutput(os.Stdout), 2, xlog.SeverityError, xlog.KeyByField("request"))
+	logger := xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+	logger.SetFlags(xlog.FlagSeverity)
+
+	request1 := logger.WithFieldKeyVals("request", 1)
+	request1.Debug("request 1: this is debug log. it won't be shown.")
+	request1.Info("request 1: this is info log. it won't be shown.")
+	fingersCrossed.EndScope("1")
+
+	request2 := logger.WithFieldKeyVals("request", 2)
+	request2.Debug("request 2: this is debug log. it will be dropped from the buffer.")
+	request2.Debug("request 2: this is debug log.")
+	request2.Info("request 2: this is info log.")
+	request2.Error("request 2: this is error log.")
+	request2.Debug("request 2: this is debug log after error.")
+	fingersCrossed.EndScope("2")
+
+	scopedLogger, scope := fingersCrossed.WithScope(logger)
+	scopedLogger.Info("scoped: this is info log. it won't be shown.")
+	_ = scope.Close()
+
+	// Output:
+	// DEBUG - request 2: this is debug log.
+	// INFO - request 2: this is info log.
+	// ERROR - request 2: this is error log.
+	// DEBUG - request 2: this is debug log after error.
+}
+
+func TestFingersCrossedOutput_buffer(t *testing.T) {
+	output := &recordOutput{}
+	fingersCrossed := xlog.NewFingersCrossedOutput(output, 3, xlog.SeverityError, nil)
+	logger := xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+
+	for i := 1; i <= 5; i++ {
+		logger.Infof("info %d", i)
+	}
+	if got := output.Messages(); len(got) != 0 {
+		t.Fatalf("got %q before trigger", got)
+	}
+	logger.Error("error")
+	logger.Info("after")
+
+	want := []string{"info 3", "info 4", "info 5", "error", "after"}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFingersCrossedOutput_scopes(t *testing.T) {
+	output := &recordOutput{}
+	fingersCrossed := xlog.NewFingersCrossedOutput(output, 10, xlog.SeverityError, xlog.KeyByField("request"))
+	logger := xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+	request1 := logger.WithFieldKeyVals("request", 1)
+	request2 := logger.WithFieldKeyVals("request", 2)
+
+	request1.Info("request 1: info")
+	request2.Info("request 2: info")
+	request2.Error("request 2: error")
+	request1.Info("request 1: info again")
+
+	want := []string{"request 2: info", "request 2: error"}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFingersCrossedOutput_close(t *testing.T) {
+	output := &recordOutput{}
+	fingersCrossed := xlog.NewFingersCrossedOutput(output, 10, xlog.SeverityError, xlog.KeyByField("request"))
+	logger := xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+	scopedLogger, scope := fingersCrossed.WithScope(logger)
+
+	logger.WithFieldKeyVals("request", 1).Info("implicit: info")
+	scopedLogger.Info("explicit: info")
+	_ = scope.Close()
+	scopedLogger.Error("explicit: error after close")
+	_ = fingersCrossed.Close()
+	logger.WithFieldKeyVals("request", 1).Error("implicit: error after close")
+
+	want := []string{"implicit: error after close"}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFingersCrossedOutput_SetScopeLimits(t *testing.T) {
+	output := &recordOutput{}
+	fingersCrossed := xlog.NewFingersCrossedOutput(output, 10, xlog.SeverityError, xlog.KeyByField("request")).
+		SetScopeLimits(2, 0)
+	logger := xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+
+	logger.WithFieldKeyVals("request", 1).Info("request 1: info")
+	logger.WithFieldKeyVals("request", 2).Info("request 2: evicted by max scopes")
+	logger.WithFieldKeyVals("request", 1).Info("request 1: info again")
+	logger.WithFieldKeyVals("request", 3).Info("request 3: info")
+	logger.WithFieldKeyVals("request", 2).Error("request 2: error")
+	logger.WithFieldKeyVals("request", 3).Error("request 3: error")
+
+	want := []string{"request 2: error", "request 3: info", "request 3: error"}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("max scopes: got %q, want %q", got, want)
+	}
+
+	output = &recordOutput{}
+	fingersCrossed = xlog.NewFingersCrossedOutput(output, 10, xlog.SeverityError, xlog.KeyByField("request")).
+		SetScopeLimits(0, 50*time.Millisecond)
+	logger = xlog.New(fingersCrossed, xlog.SeverityDebug, 0)
+
+	logger.WithFieldKeyVals("request", 1).Info("request 1: evicted by idle timeout")
+	time.Sleep(100 * time.Millisecond)
+	logger.WithFieldKeyVals("request", 2).Info("request 2: info")
+	logger.WithFieldKeyVals("request", 1).Error("request 1: error")
+	logger.WithFieldKeyVals("request", 2).Error("request 2: error")
+
+	want = []string{"request 1: error", "request 2: info", "request 2: error"}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("idle timeout: got %q, want %q", got, want)
+	}
+}
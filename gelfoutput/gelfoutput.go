@@ -2,11 +2,15 @@
 package gelfoutput
 
 import (
+	"compress/flate"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/goinsane/erf"
 	"gopkg.in/Graylog2/go-gelf.v2/gelf"
@@ -15,15 +19,28 @@ import (
 )
 
 // GelfOutput implements xlog.Output for GELF output.
+// GelfOutput queues the logs into a bounded queue, and writes them by a background goroutine. So, an unreachable
+// server doesn't block the logging goroutines.
 type GelfOutput struct {
+	dropped   uint64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
 	opts      Options
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 	mu        sync.Mutex
-	writer    gelf.Writer
+	writer    messageWriter
+	queueMu   sync.RWMutex
+	queue     chan *gelf.Message
+	closed    bool
+	wg        sync.WaitGroup
+	pendingMu sync.Mutex
+	pending   int
+	idle      chan struct{}
+	discarded int
+	state     int32
+	onError   *func(error)
 }
 
-// New creates a new GelfOutput.
+// New creates a new GelfOutput, and starts its background goroutine.
 func New(opts Options) (g *GelfOutput, err error) {
 	g = &GelfOutput{
 		opts: opts,
@@ -35,14 +52,62 @@ func New(opts Options) (g *GelfOutput, err error) {
 		}
 		g.opts.Host = h
 	}
+	switch g.opts.CompressionLevel {
+	case 0:
+		g.opts.CompressionLevel = defaultCompressionLevel
+	case NoCompressionLevel:
+		g.opts.CompressionLevel = flate.NoCompression
+	}
+	if g.opts.ChunkSize <= 0 {
+		g.opts.ChunkSize = DefaultChunkSize
+	}
+	if g.opts.ChunkSize <= chunkHeaderLen {
+		return nil, erf.Errorf("chunk size %d too small", g.opts.ChunkSize)
+	}
+	switch g.opts.FullFlags {
+	case 0:
+		g.opts.FullFlags = xlog.FlagStackTrace | xlog.FlagErfStackTrace | xlog.FlagErfMessage
+	case FullFlagsNone:
+		g.opts.FullFlags = 0
+	}
+	if g.opts.QueueSize <= 0 {
+		g.opts.QueueSize = 1024
+	}
+	if g.opts.ConnectTimeout <= 0 {
+		g.opts.ConnectTimeout = 5 * time.Second
+	}
+	if g.opts.WriteTimeout <= 0 {
+		g.opts.WriteTimeout = 5 * time.Second
+	}
+	if g.opts.RetryDelay <= 0 {
+		g.opts.RetryDelay = 250 * time.Millisecond
+	}
 	g.ctx, g.ctxCancel = context.WithCancel(context.Background())
+	g.queue = make(chan *gelf.Message, g.opts.QueueSize)
+	g.idle = make(chan struct{})
+	close(g.idle)
+	g.wg.Add(1)
+	go g.worker()
 	return g, nil
 }
 
 // Close closes GelfOutput. Unused GelfOutput must be closed for freeing resources.
+// It cancels the ongoing retries, and drops the queued logs by reporting a single error which wraps
+// xlog.ErrOutputClosed to OnError function. GelfOutput should be flushed before closing to write the queued logs.
 func (g *GelfOutput) Close() error {
 	var err error
 	g.ctxCancel()
+	g.queueMu.Lock()
+	if !g.closed {
+		g.closed = true
+		close(g.queue)
+	}
+	g.queueMu.Unlock()
+	g.wg.Wait()
+	if g.discarded > 0 {
+		g.reportError(erf.Errorf("%d queued logs dropped: %w", g.discarded, xlog.ErrOutputClosed))
+		g.discarded = 0
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	if g.writer != nil {
@@ -54,18 +119,145 @@ func (g *GelfOutput) Close() error {
 			g.writer = nil
 		}
 	}
+	atomic.StoreInt32(&g.state, int32(StateClosed))
 	return err
 }
 
+// Flush is implementation of xlog.Flusher.
+// It waits until the queued logs are written.
+func (g *GelfOutput) Flush(ctx context.Context) error {
+	g.pendingMu.Lock()
+	idle := g.idle
+	g.pendingMu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetOnError sets a function to call when writing a log fails or a log is dropped.
+// It returns underlying GelfOutput.
+func (g *GelfOutput) SetOnError(f func(error)) *GelfOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&g.onError)), unsafe.Pointer(&f))
+	return g
+}
+
+// SetErrorReporter is implementation of xlog.ErrorReporter.
+func (g *GelfOutput) SetErrorReporter(f func(error)) {
+	g.SetOnError(f)
+}
+
+// State returns the connection state of GelfOutput.
+func (g *GelfOutput) State() State {
+	return State(atomic.LoadInt32(&g.state))
+}
+
+// Dropped returns the number of the logs dropped because the queue is full or GelfOutput is closed.
+func (g *GelfOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&g.dropped)
+}
+
+// Pending returns the number of the queued logs which aren't written yet.
+func (g *GelfOutput) Pending() int {
+	g.pendingMu.Lock()
+	defer g.pendingMu.Unlock()
+	return g.pending
+}
+
 // Log is implementation of xlog.Output.
+// It queues the log without blocking. The background goroutine retries writing the log until it succeeds or
+// GelfOutput is closed. If the queue is full, it drops the log and reports xlog.ErrQueueFull to OnError function.
 func (g *GelfOutput) Log(log *xlog.Log) {
 	if g.ctx.Err() != nil {
+		atomic.AddUint64(&g.dropped, 1)
+		log.Release()
+		return
+	}
+	g.opts.MultiLine.Apply(log, func(log *xlog.Log) {
+		msg := g.newMessage(log)
+		log.Release()
+		g.enqueue(msg)
+	})
+	log.Release()
+}
+
+// TryLog is implementation of xlog.ErrorOutput.
+// It tries writing the log once synchronously, bypassing the queue.
+func (g *GelfOutput) TryLog(log *xlog.Log) error {
+	if g.ctx.Err() != nil {
+		return xlog.ErrOutputClosed
+	}
+	var err error
+	g.opts.MultiLine.Apply(log, func(log *xlog.Log) {
+		msg := g.newMessage(log)
+		log.Release()
+		if err == nil {
+			err = g.tryWriteMessage(msg)
+		}
+	})
+	return err
+}
+
+func (g *GelfOutput) enqueue(msg *gelf.Message) {
+	g.queueMu.RLock()
+	defer g.queueMu.RUnlock()
+	if g.closed {
+		atomic.AddUint64(&g.dropped, 1)
 		return
 	}
+	g.addPending(1)
+	select {
+	case g.queue <- msg:
+	default:
+		g.addPending(-1)
+		atomic.AddUint64(&g.dropped, 1)
+		g.reportError(xlog.ErrQueueFull)
+	}
+}
+
+func (g *GelfOutput) worker() {
+	defer g.wg.Done()
+	for msg := range g.queue {
+		if g.ctx.Err() != nil || !g.writeMessage(msg) {
+			atomic.AddUint64(&g.dropped, 1)
+			g.discarded++
+		}
+		g.addPending(-1)
+	}
+}
+
+// addPending adds n to the number of the queued logs, and signals Flush when it reaches 0.
+func (g *GelfOutput) addPending(n int) {
+	g.pendingMu.Lock()
+	defer g.pendingMu.Unlock()
+	if g.pending == 0 && n > 0 {
+		g.idle = make(chan struct{})
+	}
+	g.pending += n
+	if g.pending == 0 {
+		close(g.idle)
+	}
+}
+
+func (g *GelfOutput) reportError(err error) {
+	if f := (*func(error))(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&g.onError)))); f != nil && *f != nil {
+		(*f)(err)
+	}
+}
+
+func (g *GelfOutput) newMessage(log *xlog.Log) *gelf.Message {
+	if !g.opts.Limits.IsZero() && g.opts.Limits.Exceeds(log) {
+		log = g.opts.Limits.Apply(log)
+		defer log.Release()
+	}
 	level := int32(gelf.LOG_EMERG)
 	switch log.Severity {
 	case xlog.SeverityFatal:
 		level = gelf.LOG_CRIT
+	case xlog.SeverityPanic:
+		level = gelf.LOG_ALERT
 	case xlog.SeverityError:
 		level = gelf.LOG_ERR
 	case xlog.SeverityWarning:
@@ -79,7 +271,6 @@ func (g *GelfOutput) Log(log *xlog.Log) {
 		Version:  "1.1",
 		Host:     g.opts.Host,
 		Short:    string(log.Message),
-		Full:     "",
 		TimeUnix: float64(log.Time.UnixNano()) / float64(time.Second),
 		Level:    level,
 		Facility: g.opts.Facility,
@@ -88,11 +279,7 @@ func (g *GelfOutput) Log(log *xlog.Log) {
 	msg.Extra["severity"] = fmt.Sprintf("%s", log.Severity)
 	msg.Extra["verbosity"] = int(log.Verbosity)
 	if log.Error != nil {
-		format := "%v"
-		if _, ok := log.Error.(*erf.Erf); ok {
-			format = "%x"
-		}
-		msg.Extra["error"] = fmt.Sprintf(format, log.Error)
+		msg.Extra["error"] = log.ErrorText()
 	}
 	msg.Extra["file"] = log.StackCaller.File
 	msg.Extra["line"] = log.StackCaller.Line
@@ -100,46 +287,76 @@ func (g *GelfOutput) Log(log *xlog.Log) {
 	if log.StackTrace != nil {
 		msg.Extra["stack_trace"] = fmt.Sprintf("%+s", log.StackTrace)
 	}
+	full := msg.Short
 	for i := range log.Fields {
 		field := &log.Fields[i]
-		msg.Extra[fmt.Sprintf("%3.3d_%s", i, field.Key)] = field.Value
-		msg.Extra[fmt.Sprintf("_%s", field.Key)] = field.Value
+		if field.Key == xlog.FullMessageKey && g.opts.MultiLine == xlog.MultiLineFull {
+			full = fmt.Sprintf("%v", field.Value)
+			continue
+		}
+		if g.opts.FieldName == nil {
+			msg.Extra[fmt.Sprintf("%3.3d_%s", i, field.Key)] = field.Value
+			msg.Extra[fmt.Sprintf("_%s", field.Key)] = field.Value
+			continue
+		}
+		if name := g.opts.FieldName(i, field.Key); name != "" {
+			msg.Extra[name] = field.Value
+		}
 	}
-	g.writeMessage(msg)
+	msg.Full = g.fullMessage(log, full)
+	return msg
 }
 
-func (g *GelfOutput) writeMessage(msg *gelf.Message) {
-	var err error
+// fullMessage returns the text rendering of the Log for full_message by Options.FullFlags.
+func (g *GelfOutput) fullMessage(log *xlog.Log, message string) string {
+	var sb strings.Builder
+	sb.WriteString(message)
+	if g.opts.FullFlags&xlog.FlagStackTrace != 0 && log.StackTrace != nil {
+		sb.WriteString("\n\n")
+		_, _ = fmt.Fprintf(&sb, "%+1.1s", log.StackTrace)
+	}
+	if g.opts.FullFlags&xlog.FlagErfStackTrace != 0 {
+		if trace := log.ErfStackTrace(g.opts.FullFlags); trace != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(trace)
+		}
+	}
+	return sb.String()
+}
+
+// writeMessage retries writing the message until it succeeds or GelfOutput is closed, and returns whether it
+// succeeds.
+func (g *GelfOutput) writeMessage(msg *gelf.Message) bool {
+	for {
+		err := g.tryWriteMessage(msg)
+		if err == nil {
+			return true
+		}
+		g.reportError(err)
+		select {
+		case <-g.ctx.Done():
+			return false
+		case <-time.After(g.opts.RetryDelay):
+		}
+	}
+}
+
+func (g *GelfOutput) tryWriteMessage(msg *gelf.Message) (err error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	for g.ctx.Err() == nil {
-		if g.writer == nil {
-			if !g.opts.UseTCP {
-				var w *gelf.UDPWriter
-				w, err = gelf.NewUDPWriter(g.opts.Address)
-				if err != nil {
-					time.Sleep(250 * time.Millisecond)
-					continue
-				}
-				g.writer = w
-			} else {
-				var w *gelf.TCPWriter
-				w, err = gelf.NewTCPWriter(g.opts.Address)
-				if err != nil {
-					time.Sleep(250 * time.Millisecond)
-					continue
-				}
-				w.MaxReconnect = 0
-				w.ReconnectDelay = 1
-				g.writer = w
-			}
+	if g.writer == nil {
+		g.writer, err = newMessageWriter(&g.opts)
+		if err != nil {
+			atomic.StoreInt32(&g.state, int32(StateDisconnected))
+			return err
 		}
-		if err = g.writer.WriteMessage(msg); err != nil {
-			_ = g.writer.Close()
-			g.writer = nil
-			time.Sleep(250 * time.Millisecond)
-			continue
-		}
-		return
 	}
+	if err = g.writer.WriteMessage(msg); err != nil {
+		_ = g.writer.Close()
+		g.writer = nil
+		atomic.StoreInt32(&g.state, int32(StateDisconnected))
+		return erf.Errorf("unable to write message: %w", err)
+	}
+	atomic.StoreInt32(&g.state, int32(StateConnected))
+	return nil
 }
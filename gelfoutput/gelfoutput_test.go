@@ -0,0 +1,300 @@
+package gelfoutput_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goinsane/erf"
+	"gopkg.in/Graylog2/go-gelf.v2/gelf"
+
+	"github.com/goinsane/xlog"
+	"github.com/goinsane/xlog/gelfoutput"
+)
+
+func newReader(t *testing.T) *gelf.Reader {
+	t.Helper()
+	r, err := gelf.NewReader("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGelfOutput_chunked(t *testing.T) {
+	for _, compression := range []gelfoutput.Compression{gelfoutput.CompressionGzip, gelfoutput.CompressionZlib, gelfoutput.CompressionNone} {
+		r := newReader(t)
+		output, err := gelfoutput.New(gelfoutput.Options{
+			Address:     r.Addr(),
+			Host:        "test",
+			Compression: compression,
+			ChunkSize:   200,
+			FieldName: func(index int, key string) string {
+				return "_" + key
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+		message := strings.Repeat("0123456789", 100)
+		logger.WithFieldKeyVals("key", "value").Info(message)
+
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("compression %d: %v", compression, err)
+		}
+		if msg.Short != message || msg.Full != message {
+			t.Errorf("compression %d: unexpected message %q, %q", compression, msg.Short, msg.Full)
+		}
+		if msg.Extra["_key"] != "value" || msg.Extra["000_key"] != nil {
+			t.Errorf("compression %d: unexpected extra %v", compression, msg.Extra)
+		}
+		_ = output.Close()
+	}
+}
+
+func TestGelfOutput_fullMessage(t *testing.T) {
+	r := newReader(t)
+	output, err := gelfoutput.New(gelfoutput.Options{
+		Address:   r.Addr(),
+		Host:      "test",
+		MultiLine: xlog.MultiLineFull,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	logger.Error("first\nsecond: ", erf.New("failed"))
+
+	msg, err := r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Short != "first" {
+		t.Errorf("short = %q", msg.Short)
+	}
+	if !strings.HasPrefix(msg.Full, "first\nsecond: failed\n\n") || !strings.Contains(msg.Full, "gelfoutput_test.TestGelfOutput_fullMessage") {
+		t.Errorf("full = %q", msg.Full)
+	}
+	if msg.Extra["_full_message"] != nil {
+		t.Errorf("unexpected extra %v", msg.Extra)
+	}
+
+	logger.Error(erf.New("third\nfourth"))
+
+	msg, err = r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Short != "third" {
+		t.Errorf("short = %q", msg.Short)
+	}
+	if !strings.HasPrefix(msg.Full, "third\nfourth\n") || !strings.Contains(msg.Full, "gelfoutput_test.TestGelfOutput_fullMessage") {
+		t.Errorf("full = %q", msg.Full)
+	}
+}
+
+func TestGelfOutput_FullFlagsNone(t *testing.T) {
+	r := newReader(t)
+	output, err := gelfoutput.New(gelfoutput.Options{
+		Address:          r.Addr(),
+		Host:             "test",
+		CompressionLevel: gelfoutput.NoCompressionLevel,
+		FullFlags:        gelfoutput.FullFlagsNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	logger := xlog.New(output, xlog.SeverityInfo, 0).SetStackTraceSeverity(xlog.SeverityInfo)
+
+	logger.Error("bare: ", erf.New("failed"))
+
+	msg, err := r.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Full != "bare: failed" {
+		t.Errorf("full = %q", msg.Full)
+	}
+}
+
+func TestNew_chunkSize(t *testing.T) {
+	_, err := gelfoutput.New(gelfoutput.Options{Host: "test", ChunkSize: 12})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestGelfOutput_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGelfOutputTCP(t, ln, nil)
+}
+
+func TestGelfOutput_tls(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	testGelfOutputTCP(t, ln, &tls.Config{RootCAs: roots})
+}
+
+func testGelfOutputTCP(t *testing.T, ln net.Listener, tlsConfig *tls.Config) {
+	t.Helper()
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			data, err := r.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			var msg gelf.Message
+			if err := json.Unmarshal(data[:len(data)-1], &msg); err == nil {
+				received <- msg.Short
+			}
+		}
+	}()
+
+	output, err := gelfoutput.New(gelfoutput.Options{
+		Address:   ln.Addr().String(),
+		UseTCP:    true,
+		Host:      "test",
+		TLSConfig: tlsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	output.SetOnError(func(err error) { t.Error(err) })
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	logger.Info("first")
+	logger.Info("second")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := output.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting %q", want)
+		}
+	}
+	if state := output.State(); state != gelfoutput.StateConnected {
+		t.Errorf("state = %v", state)
+	}
+}
+
+func TestGelfOutput_unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	_ = ln.Close()
+
+	output, err := gelfoutput.New(gelfoutput.Options{
+		Address:    address,
+		UseTCP:     true,
+		Host:       "test",
+		QueueSize:  2,
+		RetryDelay: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var errs []error
+	output.SetOnError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		logger.Info("unreachable")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("logging blocked for %v", d)
+	}
+	if dropped := output.Dropped(); dropped < 7 {
+		t.Errorf("dropped = %d, want at least 7", dropped)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := output.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("flush error = %v", err)
+	}
+	if state := output.State(); state != gelfoutput.StateDisconnected {
+		t.Errorf("state = %v", state)
+	}
+
+	start = time.Now()
+	if err := output.Close(); err != nil {
+		t.Error(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("close blocked for %v", d)
+	}
+	if state := output.State(); state != gelfoutput.StateClosed {
+		t.Errorf("state = %v", state)
+	}
+	if dropped := output.Dropped(); dropped != 10 {
+		t.Errorf("dropped = %d, want 10", dropped)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	queueFull, writeFailed, closed := 0, 0, 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, xlog.ErrQueueFull):
+			queueFull++
+		case errors.Is(err, xlog.ErrOutputClosed):
+			closed++
+			if want := fmt.Sprintf("%d queued logs dropped", 10-queueFull); !strings.Contains(err.Error(), want) {
+				t.Errorf("close error %q, want %q", err, want)
+			}
+		default:
+			writeFailed++
+		}
+	}
+	if queueFull < 7 || queueFull > 8 || writeFailed != 1 || closed != 1 {
+		t.Errorf("%d queue full errors, %d write errors, %d close errors", queueFull, writeFailed, closed)
+	}
+}
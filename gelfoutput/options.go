@@ -1,9 +1,76 @@
 package gelfoutput
 
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+const (
+	// NoCompressionLevel sets Options.CompressionLevel to flate.NoCompression.
+	NoCompressionLevel = -100
+
+	// FullFlagsNone sets Options.FullFlags to write only the message to full_message.
+	FullFlagsNone xlog.Flag = -1
+)
+
 // Options defines several GELF options.
 type Options struct {
 	Address  string
 	UseTCP   bool
 	Host     string
 	Facility string
+
+	// Compression is the compression of UDP messages.
+	// By default, CompressionGzip.
+	Compression Compression
+
+	// CompressionLevel is the compression level of UDP messages, one of the levels of compress/flate. As 0 means the
+	// default, flate.NoCompression is set by NoCompressionLevel.
+	// By default, flate.BestSpeed.
+	CompressionLevel int
+
+	// ChunkSize is the maximum size of UDP datagrams. The larger messages are chunked. It must be greater than 12.
+	// By default, DefaultChunkSize.
+	ChunkSize int
+
+	// TLSConfig enables TLS for TCP if it isn't nil.
+	TLSConfig *tls.Config
+
+	// QueueSize is the maximum number of the queued logs. The logs exceeding QueueSize are dropped.
+	// By default, 1024.
+	QueueSize int
+
+	// ConnectTimeout is the timeout of connecting to the server.
+	// By default, 5s.
+	ConnectTimeout time.Duration
+
+	// WriteTimeout is the timeout of writing a message to the server.
+	// By default, 5s.
+	WriteTimeout time.Duration
+
+	// RetryDelay is the delay between the attempts to write a queued log.
+	// By default, 250ms.
+	RetryDelay time.Duration
+
+	// FieldName returns the GELF additional field name of the field of Log at the given index. If it returns an empty
+	// string, the field is skipped. If it is nil, every field is written twice as "%3.3d_%s" and "_%s".
+	FieldName func(index int, key string) string
+
+	// FullFlags defines what full_message has besides the message: FlagStackTrace adds the stack trace, and
+	// FlagErfStackTrace adds the erf error with its stack trace. FlagErfMessage and FlagErfFields are applied like
+	// xlog.TextOutput.
+	// As 0 means the default, FullFlagsNone writes only the message to full_message.
+	// By default, FlagStackTrace | FlagErfStackTrace | FlagErfMessage.
+	FullFlags xlog.Flag
+
+	// Limits defines the size limits of the logs, e.g. to keep the messages under the UDP limits.
+	// By default, unlimited.
+	Limits xlog.Limits
+
+	// MultiLine defines how the multi-line messages and error texts are handled. MultiLineFull moves them into the
+	// GELF full_message.
+	// By default, xlog.MultiLineKeep.
+	MultiLine xlog.MultiLinePolicy
 }
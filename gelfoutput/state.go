@@ -0,0 +1,29 @@
+package gelfoutput
+
+// State is the connection state of GelfOutput.
+type State int32
+
+const (
+	// StateDisconnected means GelfOutput isn't connected, or the last write has failed.
+	StateDisconnected State = iota
+
+	// StateConnected means the last write has succeeded.
+	StateConnected
+
+	// StateClosed means GelfOutput is closed.
+	StateClosed
+)
+
+// String is implementation of fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
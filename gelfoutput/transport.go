@@ -0,0 +1,200 @@
+package gelfoutput
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/goinsane/erf"
+	"gopkg.in/Graylog2/go-gelf.v2/gelf"
+)
+
+// Compression defines the compression of GELF UDP messages.
+type Compression int
+
+const (
+	// CompressionGzip compresses the messages by gzip.
+	CompressionGzip Compression = iota
+
+	// CompressionZlib compresses the messages by zlib.
+	CompressionZlib
+
+	// CompressionNone doesn't compress the messages.
+	CompressionNone
+)
+
+const (
+	// DefaultChunkSize is the default size of GELF UDP chunks. It should be less than the MTU minus the UDP header.
+	DefaultChunkSize = 1420
+
+	chunkHeaderLen = 12
+	maxChunks      = 128
+
+	defaultCompressionLevel = flate.BestSpeed
+)
+
+var magicChunked = []byte{0x1e, 0x0f}
+
+// messageWriter writes GELF messages to a connection.
+type messageWriter interface {
+	WriteMessage(msg *gelf.Message) error
+	Close() error
+}
+
+// udpWriter writes GELF messages as UDP datagrams, compressed and chunked by the options.
+type udpWriter struct {
+	conn             net.Conn
+	writeTimeout     time.Duration
+	compression      Compression
+	compressionLevel int
+	chunkSize        int
+}
+
+func (w *udpWriter) WriteMessage(msg *gelf.Message) error {
+	var buf bytes.Buffer
+	if err := msg.MarshalJSONBuf(&buf); err != nil {
+		return erf.Errorf("unable to encode message: %w", err)
+	}
+	data := buf.Bytes()
+
+	var zw io.WriteCloser
+	var zBuf bytes.Buffer
+	var err error
+	switch w.compression {
+	case CompressionGzip:
+		zw, err = gzip.NewWriterLevel(&zBuf, w.compressionLevel)
+	case CompressionZlib:
+		zw, err = zlib.NewWriterLevel(&zBuf, w.compressionLevel)
+	case CompressionNone:
+	default:
+		return erf.Errorf("unknown compression %d", w.compression)
+	}
+	if err != nil {
+		return erf.Errorf("unable to create compressor: %w", err)
+	}
+	if zw != nil {
+		if _, err = zw.Write(data); err != nil {
+			_ = zw.Close()
+			return erf.Errorf("unable to compress message: %w", err)
+		}
+		if err = zw.Close(); err != nil {
+			return erf.Errorf("unable to compress message: %w", err)
+		}
+		data = zBuf.Bytes()
+	}
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return erf.Errorf("unable to set write deadline: %w", err)
+	}
+	if len(data) <= w.chunkSize {
+		return writeFull(w.conn, data)
+	}
+	return w.writeChunked(data)
+}
+
+// writeChunked writes the data as GELF chunks: 2 bytes magic, 8 bytes message id, 1 byte sequence number, 1 byte
+// sequence count and the chunk data.
+func (w *udpWriter) writeChunked(data []byte) error {
+	chunkDataLen := w.chunkSize - chunkHeaderLen
+	count := (len(data) + chunkDataLen - 1) / chunkDataLen
+	if count > maxChunks {
+		return erf.Errorf("message too large, would need %d chunks", count)
+	}
+	var id [8]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return erf.Errorf("unable to generate message id: %w", err)
+	}
+	chunk := make([]byte, 0, w.chunkSize)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkDataLen
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk[:0], magicChunked...)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[i*chunkDataLen:end]...)
+		if err := writeFull(w.conn, chunk); err != nil {
+			return erf.Errorf("unable to write chunk %d/%d: %w", i+1, count, err)
+		}
+	}
+	return nil
+}
+
+func (w *udpWriter) Close() error {
+	return w.conn.Close()
+}
+
+// tcpWriter writes GELF messages delimited by null bytes to a TCP or TLS connection.
+type tcpWriter struct {
+	conn         net.Conn
+	writeTimeout time.Duration
+}
+
+func (w *tcpWriter) WriteMessage(msg *gelf.Message) error {
+	var buf bytes.Buffer
+	if err := msg.MarshalJSONBuf(&buf); err != nil {
+		return erf.Errorf("unable to encode message: %w", err)
+	}
+	buf.WriteByte(0)
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return erf.Errorf("unable to set write deadline: %w", err)
+	}
+	return writeFull(w.conn, buf.Bytes())
+}
+
+func (w *tcpWriter) Close() error {
+	return w.conn.Close()
+}
+
+// newMessageWriter connects to the address by the options, and returns a new messageWriter.
+func newMessageWriter(opts *Options) (messageWriter, error) {
+	dialer := &net.Dialer{
+		Timeout: opts.ConnectTimeout,
+	}
+	if !opts.UseTCP {
+		conn, err := dialer.Dial("udp", opts.Address)
+		if err != nil {
+			return nil, erf.Errorf("unable to dial udp: %w", err)
+		}
+		return &udpWriter{
+			conn:             conn,
+			writeTimeout:     opts.WriteTimeout,
+			compression:      opts.Compression,
+			compressionLevel: opts.CompressionLevel,
+			chunkSize:        opts.ChunkSize,
+		}, nil
+	}
+	var conn net.Conn
+	var err error
+	if opts.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", opts.Address, opts.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", opts.Address)
+	}
+	if err != nil {
+		return nil, erf.Errorf("unable to dial tcp: %w", err)
+	}
+	return &tcpWriter{
+		conn:         conn,
+		writeTimeout: opts.WriteTimeout,
+	}, nil
+}
+
+func writeFull(w io.Writer, data []byte) error {
+	n, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("short write (%d/%d)", n, len(data))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package xlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/goinsane/erf"
+)
+
+// logJSON is the stable JSON form of Log.
+type logJSON struct {
+	Message    string            `json:"message"`
+	Error      *string           `json:"error,omitempty"`
+	Severity   Severity          `json:"severity"`
+	Verbosity  Verbose           `json:"verbosity"`
+	Time       time.Time         `json:"time"`
+	Fields     []fieldJSON       `json:"fields,omitempty"`
+	Caller     *stackCallerJSON  `json:"caller,omitempty"`
+	StackTrace []stackCallerJSON `json:"stack_trace,omitempty"`
+	Flags      Flag              `json:"flags"`
+}
+
+type fieldJSON struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Mark  string          `json:"mark,omitempty"`
+}
+
+type stackCallerJSON struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// MarshalJSON is implementation of json.Marshaler.
+// The field values which can't be encoded as JSON are encoded as the strings of their fmt.Sprintf("%v") forms.
+func (l *Log) MarshalJSON() ([]byte, error) {
+	j := &logJSON{
+		Message:   string(l.Message),
+		Severity:  l.Severity,
+		Verbosity: l.Verbosity,
+		Time:      l.Time,
+		Flags:     l.Flags,
+	}
+	if l.Error != nil {
+		s := l.ErrorText()
+		j.Error = &s
+	}
+	if len(l.Fields) > 0 {
+		j.Fields = make([]fieldJSON, 0, len(l.Fields))
+		for i := range l.Fields {
+			field := &l.Fields[i]
+			value, err := json.Marshal(field.Value)
+			if err != nil {
+				value, _ = json.Marshal(fmt.Sprintf("%v", field.Value))
+			}
+			f := fieldJSON{
+				Key:   field.Key,
+				Value: value,
+			}
+			if field.mark != nil {
+				f.Mark = fmt.Sprintf("%v", field.mark)
+			}
+			j.Fields = append(j.Fields, f)
+		}
+	}
+	if l.StackCaller.Function != "" || l.StackCaller.File != "" {
+		j.Caller = &stackCallerJSON{
+			Function: l.StackCaller.Function,
+			File:     l.StackCaller.File,
+			Line:     l.StackCaller.Line,
+		}
+	}
+	if l.StackTrace != nil {
+		j.StackTrace = make([]stackCallerJSON, 0, l.StackTrace.Len())
+		for i, n := 0, l.StackTrace.Len(); i < n; i++ {
+			c := l.StackTrace.Caller(i)
+			j.StackTrace = append(j.StackTrace, stackCallerJSON{
+				Function: c.Function,
+				File:     c.File,
+				Line:     c.Line,
+			})
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON is implementation of json.Unmarshaler.
+// The error is restored as a plain error which has the same text. The stack trace can't be restored, so StackTrace
+// is left nil. The numeric field values are restored as json.Number.
+func (l *Log) UnmarshalJSON(data []byte) error {
+	var j logJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	l.Message = append(l.Message[:0], j.Message...)
+	l.Error = nil
+	if j.Error != nil {
+		l.Error = errors.New(*j.Error)
+	}
+	l.Severity = j.Severity
+	l.Verbosity = j.Verbosity
+	l.Time = j.Time
+	l.Fields = l.Fields[:0]
+	for _, f := range j.Fields {
+		var value interface{}
+		dec := json.NewDecoder(bytes.NewReader(f.Value))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		field := Field{
+			Key:   f.Key,
+			Value: value,
+		}
+		if f.Mark != "" {
+			m := &FieldMarkErf{}
+			if _, err := fmt.Sscanf(f.Mark, "%d:%d", &m.No, &m.Index); err == nil {
+				field.mark = m
+			}
+		}
+		l.Fields = append(l.Fields, field)
+	}
+	l.StackCaller = erf.StackCaller{}
+	if j.Caller != nil {
+		l.StackCaller.Frame = runtime.Frame{
+			Function: j.Caller.Function,
+			File:     j.Caller.File,
+			Line:     j.Caller.Line,
+		}
+	}
+	l.StackTrace = nil
+	l.Flags = j.Flags
+	return nil
+}
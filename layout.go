@@ -0,0 +1,328 @@
+package xlog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLayout = errors.New("invalid layout")
+)
+
+// Layout is a compiled text layout of Log. It is safe for concurrent use.
+type Layout struct {
+	pattern   string
+	appenders []layoutAppender
+}
+
+// layoutAppender appends a part of the layout of the Log to b.
+type layoutAppender func(b []byte, log *Log, flags Flag, tf *textFormat) []byte
+
+var layoutTimeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+// ParseLayout parses a layout pattern and returns the compiled Layout.
+//
+// A pattern consists of literal texts and directives. A directive starts with "%", and some of them take an argument
+// in braces. A newline is appended to the end of the layout if the pattern doesn't end with a newline.
+//
+// Directives:
+//
+//	%time               the time of the Log by the TimeFormat of the Output, by default: 2009/01/23 01:23:23.123123
+//	%time{LAYOUT}       the time of the Log by a time layout name like RFC3339Nano, or a time.Format layout
+//	%level              the severity of the Log: WARNING
+//	%level{lower}       the severity of the Log in lower case: warning
+//	%caller             the short file name and line number of the StackCaller of the Log: d.go:23
+//	%caller{long}       the full file name and line number of the StackCaller of the Log: a/b/c/d.go:23
+//	%func               the short function name of the StackCaller of the Log: d.Func1
+//	%func{long}         the full function name of the StackCaller of the Log: a/b/c/d.Func1
+//	%msg                the message of the Log
+//	%error              the error text of the Log if there is
+//	%verbosity          the verbosity of the Log
+//	%fields             the fields of the Log: "key1"="value1" "key2"="value2"
+//	%field{KEY}         the value of the last field which has the key
+//	%stacktrace         the stack trace of the Log if there is
+//	%%                  a percent sign
+//
+// The time is in the location of the TimeFormat of the Output if there is, otherwise in the local time zone, or in UTC
+// if the Log has FlagUTC.
+//
+// For example:
+//
+//	%time{RFC3339Nano} [%level] %caller %msg %fields
+func ParseLayout(pattern string) (*Layout, error) {
+	l := &Layout{
+		pattern: pattern,
+	}
+	literal := make([]byte, 0, len(pattern))
+	flushLiteral := func() {
+		if len(literal) > 0 {
+			l.appenders = append(l.appenders, layoutLiteral(string(literal)))
+			literal = literal[:0]
+		}
+	}
+	for pos := 0; pos < len(pattern); {
+		c := pattern[pos]
+		if c != '%' {
+			literal = append(literal, c)
+			pos++
+			continue
+		}
+		start := pos
+		pos++
+		if pos < len(pattern) && pattern[pos] == '%' {
+			literal = append(literal, '%')
+			pos++
+			continue
+		}
+		nameStart := pos
+		for pos < len(pattern) && 'a' <= pattern[pos] && pattern[pos] <= 'z' {
+			pos++
+		}
+		name := pattern[nameStart:pos]
+		if name == "" {
+			return nil, fmt.Errorf("%w at offset %d: missing directive name", ErrInvalidLayout, start)
+		}
+		var arg string
+		hasArg := false
+		if pos < len(pattern) && pattern[pos] == '{' {
+			end := strings.IndexByte(pattern[pos:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("%w at offset %d: unterminated argument", ErrInvalidLayout, pos)
+			}
+			arg, hasArg = pattern[pos+1:pos+end], true
+			pos += end + 1
+		}
+		appender, err := newLayoutAppender(name, arg, hasArg)
+		if err != nil {
+			return nil, fmt.Errorf("%w at offset %d: %s", ErrInvalidLayout, start, err.Error())
+		}
+		flushLiteral()
+		l.appenders = append(l.appenders, appender)
+	}
+	if !strings.HasSuffix(pattern, "\n") {
+		literal = append(literal, '\n')
+	}
+	flushLiteral()
+	return l, nil
+}
+
+// MustParseLayout is like ParseLayout, but panics if the pattern cannot be parsed.
+func MustParseLayout(pattern string) *Layout {
+	l, err := ParseLayout(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// String is implementation of fmt.Stringer.
+// It returns the pattern of the Layout.
+func (l *Layout) String() string {
+	return l.pattern
+}
+
+// AppendLog appends the text of the Log by the Layout to b, and returns the extended buffer.
+func (l *Layout) AppendLog(b []byte, log *Log) []byte {
+	return l.appendLog(b, log, log.Flags, &defaultTextFormat)
+}
+
+func (l *Layout) appendLog(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+	for _, appender := range l.appenders {
+		b = appender(b, log, flags, tf)
+	}
+	return b
+}
+
+func layoutLiteral(text string) layoutAppender {
+	return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+		return append(b, text...)
+	}
+}
+
+func newLayoutAppender(name string, arg string, hasArg bool) (layoutAppender, error) {
+	noArg := func(appender layoutAppender) (layoutAppender, error) {
+		if hasArg {
+			return nil, fmt.Errorf("directive %q takes no argument", name)
+		}
+		return appender, nil
+	}
+	switch name {
+	case "time":
+		if !hasArg {
+			return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+				return tf.time.appendTime(b, log.Time, FlagDate|FlagTime|FlagMicroseconds|flags&FlagUTC)
+			}, nil
+		}
+		layout := arg
+		if l, ok := layoutTimeLayouts[arg]; ok {
+			layout = l
+		}
+		if layout == "" {
+			return nil, errors.New("empty time layout")
+		}
+		return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			return tf.time.in(log.Time, flags).AppendFormat(b, layout)
+		}, nil
+
+	case "level":
+		lower := false
+		switch {
+		case !hasArg:
+		case arg == "lower":
+			lower = true
+		default:
+			return nil, fmt.Errorf("unknown argument %q of directive %q", arg, name)
+		}
+		return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			if tf.color {
+				b = append(b, severityColor(log.Severity)...)
+			}
+			if lower {
+				text := log.Severity.String()
+				for i := 0; i < len(text); i++ {
+					b = append(b, text[i]-'A'+'a')
+				}
+			} else {
+				b = append(b, log.Severity.String()...)
+			}
+			if tf.color {
+				b = append(b, colorReset...)
+			}
+			return b
+		}, nil
+
+	case "caller", "func":
+		long := false
+		switch {
+		case !hasArg:
+		case arg == "long":
+			long = true
+		default:
+			return nil, fmt.Errorf("unknown argument %q of directive %q", arg, name)
+		}
+		if name == "func" {
+			return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+				fn := "???"
+				if log.StackCaller.Function != "" {
+					fn = callerFunc(log.StackCaller.Function, log.StackCaller.File, tf.callerPath)
+				}
+				if !long {
+					fn = trimDirs(fn)
+				}
+				return append(b, fn...)
+			}, nil
+		}
+		return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			file := "???"
+			if log.StackCaller.File != "" {
+				file = callerPath(log.StackCaller.File, log.StackCaller.Function, tf.callerPath)
+				if !long {
+					file = trimDirs(file)
+				}
+			}
+			b = append(b, file...)
+			b = append(b, ':')
+			line := 0
+			if log.StackCaller.Line > 0 {
+				line = log.StackCaller.Line
+			}
+			return strconv.AppendInt(b, int64(line), 10)
+		}, nil
+
+	case "msg":
+		return noArg(func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			return appendEscapedBytes(b, log.Message, tf.escape)
+		})
+
+	case "error":
+		return noArg(func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			if log.Error == nil {
+				return b
+			}
+			return appendEscaped(b, log.ErrorText(), tf.escape)
+		})
+
+	case "verbosity":
+		return noArg(func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			return strconv.AppendInt(b, int64(log.Verbosity), 10)
+		})
+
+	case "fields":
+		return noArg(func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			for idx := range log.Fields {
+				field := &log.Fields[idx]
+				if idx > 0 {
+					b = append(b, ' ')
+				}
+				if tf.color {
+					b = append(b, colorKey...)
+				}
+				b = field.appendKey(b)
+				if tf.color {
+					b = append(b, colorReset...)
+				}
+				b = append(b, '=')
+				b = appendQuotedValue(b, field.Value)
+			}
+			return b
+		})
+
+	case "field":
+		if !hasArg || arg == "" {
+			return nil, fmt.Errorf("directive %q requires a key", name)
+		}
+		return func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			field, ok := lookupField(log.Fields, arg)
+			if !ok {
+				return b
+			}
+			if tf.escape == EscapeNone {
+				return appendValue(b, field.Value)
+			}
+			start := len(b)
+			b = appendValue(b, field.Value)
+			buf := getBuffer()
+			buf.b = append(buf.b, b[start:]...)
+			b = appendEscapedBytes(b[:start], buf.b, tf.escape)
+			putBuffer(buf)
+			return b
+		}, nil
+
+	case "stacktrace":
+		return noArg(func(b []byte, log *Log, flags Flag, tf *textFormat) []byte {
+			if log.StackTrace == nil {
+				return b
+			}
+			if tf.color {
+				b = append(b, colorDim...)
+			}
+			b = appendStackTrace(b, log.StackTrace, tf.callerPath)
+			if tf.color {
+				b = append(b, colorReset...)
+			}
+			return b
+		})
+
+	default:
+		return nil, fmt.Errorf("unknown directive %q", name)
+	}
+}
@@ -0,0 +1,58 @@
+package xlog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleParseLayout() {
+	output := xlog.NewTextOutput(os.Stdout)
+	output.SetLayout(xlog.MustParseLayout(`%time{RFC3339Nano} [%level] %func %msg %fields`))
+	logger := xlog.New(output, xlog.SeverityInfo, 0).
+		WithTime(time.Date(2009, 1, 23, 1, 23, 23, 123123123, time.UTC)).
+		WithFieldKeyVals("key1", "value1", "key2", 2)
+	logger.SetFlags(xlog.FlagUTC)
+
+	logger.Info("this is info log.")
+	logger.Warning("this is warning log.")
+
+	output.SetLayout(xlog.MustParseLayout(`%time %level{lower} key1=%field{key1}: %msg%%`))
+	logger.Error("this is error log.")
+
+	// Output:
+	// 2009-01-23T01:23:23.123123123Z [INFO] xlog_test.ExampleParseLayout this is info log. "key1"="value1" "key2"="2"
+	// 2009-01-23T01:23:23.123123123Z [WARNING] xlog_test.ExampleParseLayout this is warning log. "key1"="value1" "key2"="2"
+	// 2009/01/23 01:23:23.123123 error key1=value1: this is error log.%
+}
+
+func TestParseLayout_invalid(t *testing.T) {
+	for _, pattern := range []string{
+		"%",
+		"%unknown",
+		"%time{RFC3339",
+		"%time{}",
+		"%msg{arg}",
+		"%level{upper}",
+		"%field",
+	} {
+		if _, err := xlog.ParseLayout(pattern); !errors.Is(err, xlog.ErrInvalidLayout) {
+			t.Errorf("pattern %q: error %v, want %v", pattern, err, xlog.ErrInvalidLayout)
+		}
+	}
+}
+
+func BenchmarkTextOutput_layout(b *testing.B) {
+	output := xlog.NewTextOutput(ioutil.Discard)
+	output.SetLayout(xlog.MustParseLayout(`%time{RFC3339Nano} [%level] %caller %msg %fields`))
+	logger := xlog.New(output, xlog.SeverityInfo, 0).WithFieldKeyVals("key1", "value1", "key2", 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark")
+	}
+}
@@ -0,0 +1,63 @@
+package xlog
+
+import (
+	"context"
+)
+
+// Flusher is an interface for the Outputs which can flush the logs they hold.
+// The wrapper Outputs forward Flush to their underlying Outputs.
+type Flusher interface {
+	// Flush writes the logs held by the Output, and waits until they are written or ctx is done.
+	Flush(ctx context.Context) error
+}
+
+// Closer is an interface for the Outputs which hold resources.
+// The wrapper Outputs forward Close to their underlying Outputs. An Output must not be used after it is closed.
+type Closer interface {
+	Close() error
+}
+
+// ErrorReporter is an interface for the Outputs which report their errors to a function.
+// The wrapper Outputs forward SetErrorReporter to their underlying Outputs.
+type ErrorReporter interface {
+	// SetErrorReporter sets a function to call when error occurs. It is same with SetOnError method of the Output.
+	SetErrorReporter(f func(error))
+}
+
+// flushOutput flushes output if it implements Flusher.
+func flushOutput(ctx context.Context, output Output) error {
+	if f, ok := output.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// closeOutput closes output if it implements Closer. Unlike QueuedOutput.Close, it closes the underlying output of
+// QueuedOutput as well.
+func closeOutput(output Output) error {
+	if q, ok := output.(*QueuedOutput); ok {
+		return q.closeAll()
+	}
+	if c, ok := output.(Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// setErrorReporter sets the error reporter of output if it implements ErrorReporter.
+func setErrorReporter(output Output, f func(error)) {
+	if r, ok := output.(ErrorReporter); ok {
+		r.SetErrorReporter(f)
+	}
+}
+
+// Shutdown flushes and closes the Output of the default Logger and all the Outputs under it by given context.
+// It should be called before the program exits. It returns the first error.
+func Shutdown(ctx context.Context) error {
+	output := defaultLogger.loadConfig().output
+	err := flushOutput(ctx, output)
+	if e := closeOutput(output); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package xlog_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+// lifecycleOutput counts the logs, flushes and closes.
+type lifecycleOutput struct {
+	logs    int32
+	flushes int32
+	closes  int32
+	onError func(error)
+}
+
+func (o *lifecycleOutput) Log(log *xlog.Log) {
+	atomic.AddInt32(&o.logs, 1)
+	log.Release()
+}
+
+func (o *lifecycleOutput) Flush(ctx context.Context) error {
+	atomic.AddInt32(&o.flushes, 1)
+	return nil
+}
+
+func (o *lifecycleOutput) Close() error {
+	atomic.AddInt32(&o.closes, 1)
+	return nil
+}
+
+func (o *lifecycleOutput) SetErrorReporter(f func(error)) {
+	o.onError = f
+}
+
+func TestShutdown(t *testing.T) {
+	outputs := []*lifecycleOutput{{}, {}, {}}
+	queued := xlog.NewQueuedOutput(outputs[1], 16)
+	output := xlog.MultiOutput(
+		xlog.FilterOutput(outputs[0], nil),
+		queued,
+		xlog.AsyncOutput(xlog.NewRetryOutput(xlog.NewFailoverOutput(xlog.NewTextOutput(&bytes.Buffer{}), outputs[2]),
+			xlog.RetryOptions{})),
+	)
+	output.(xlog.ErrorReporter).SetErrorReporter(func(error) {})
+
+	logger := xlog.DefaultLogger()
+	defer logger.SetOutput(xlog.DefaultOutput())
+	logger.SetOutput(output)
+	for i := 0; i < 10; i++ {
+		xlog.Info("shutdown.")
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := xlog.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range outputs {
+		if o.onError == nil {
+			t.Errorf("output %d has no error reporter", i)
+		}
+		if n := atomic.LoadInt32(&o.flushes); n != 1 {
+			t.Errorf("output %d flushed %d times, want 1", i, n)
+		}
+		if n := atomic.LoadInt32(&o.closes); n != 1 {
+			t.Errorf("output %d closed %d times, want 1", i, n)
+		}
+	}
+	if n := atomic.LoadInt32(&outputs[1].logs); n != 10 {
+		t.Errorf("queued output has %d logs, want 10", n)
+	}
+}
+
+func TestQueuedOutput_Close(t *testing.T) {
+	output := &lifecycleOutput{}
+	queued := xlog.NewQueuedOutput(output, 16)
+	if err := queued.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&output.closes); n != 0 {
+		t.Errorf("output closed %d times, want 0", n)
+	}
+}
+
+func TestTextOutput_Flush(t *testing.T) {
+	var buf bytes.Buffer
+	output := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity)
+	queued := xlog.NewQueuedOutput(output, 16)
+	defer queued.Close()
+	logger := xlog.New(queued, xlog.SeverityInfo, 0)
+	for i := 0; i < 3; i++ {
+		logger.Info("flush.")
+	}
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := queued.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "INFO - flush.\n"); n != 3 {
+		t.Errorf("written %d logs, want 3", n)
+	}
+}
@@ -0,0 +1,201 @@
+package xlog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/goinsane/erf"
+)
+
+// Limits defines the size limits of Log. A limit which is 0 or less means unlimited. The zero value is unlimited.
+//
+// The message and the field values which exceed the limits are truncated at a UTF-8 boundary with the marker
+// "...[truncated N bytes]". If the fields exceed the limit, the last field in the limit is replaced with a field
+// which has the key "..." and the value "[truncated N fields]", so the marker counts toward the limit. The stack trace frames which exceed the limit are removed.
+type Limits struct {
+	// MaxMessageLen is the maximum length of the message in bytes.
+	MaxMessageLen int
+
+	// MaxFieldValueLen is the maximum length of the text form of a field value in bytes. The values which exceed the
+	// limit are replaced with their truncated text forms.
+	MaxFieldValueLen int
+
+	// MaxFields is the maximum number of the fields.
+	MaxFields int
+
+	// MaxStackTraceDepth is the maximum number of the stack trace frames.
+	MaxStackTraceDepth int
+}
+
+// IsZero reports whether the Limits is unlimited.
+func (l Limits) IsZero() bool {
+	return l.MaxMessageLen <= 0 && l.MaxFieldValueLen <= 0 && l.MaxFields <= 0 && l.MaxStackTraceDepth <= 0
+}
+
+// Exceeds reports whether the Log exceeds any limit.
+func (l Limits) Exceeds(log *Log) bool {
+	if l.MaxMessageLen > 0 && len(log.Message) > l.MaxMessageLen {
+		return true
+	}
+	if l.MaxFields > 0 && len(log.Fields) > l.MaxFields {
+		return true
+	}
+	if l.MaxStackTraceDepth > 0 && log.StackTrace != nil && log.StackTrace.Len() > l.MaxStackTraceDepth {
+		return true
+	}
+	if l.MaxFieldValueLen > 0 {
+		for i := range log.Fields {
+			if _, ok := l.truncateValue(log.Fields[i].Value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply returns the Log limited by the Limits. If the Log exceeds any limit, it returns a truncated duplicate of the
+// Log, otherwise it returns the given Log with a new reference. The caller keeps its reference of the given Log, and
+// must release the returned Log.
+func (l Limits) Apply(log *Log) *Log {
+	if !l.Exceeds(log) {
+		log.retain(1)
+		return log
+	}
+	log = log.Duplicate()
+	l.truncate(log)
+	return log
+}
+
+// truncate truncates the Log in place.
+func (l Limits) truncate(log *Log) {
+	if l.MaxMessageLen > 0 && len(log.Message) > l.MaxMessageLen {
+		n := truncateLen(log.Message, l.MaxMessageLen)
+		log.Message = appendTruncated(log.Message[:n], len(log.Message)-n)
+	}
+	if l.MaxFieldValueLen > 0 {
+		for i := range log.Fields {
+			if value, ok := l.truncateValue(log.Fields[i].Value); ok {
+				log.Fields[i].Value = value
+			}
+		}
+	}
+	if l.MaxFields > 0 && len(log.Fields) > l.MaxFields {
+		keep := l.MaxFields - 1
+		n := len(log.Fields) - keep
+		for i := keep; i < len(log.Fields); i++ {
+			log.Fields[i] = Field{}
+		}
+		log.Fields = append(log.Fields[:keep], Field{
+			Key:   "...",
+			Value: "[truncated " + strconv.Itoa(n) + " fields]",
+		})
+	}
+	if l.MaxStackTraceDepth > 0 && log.StackTrace != nil && log.StackTrace.Len() > l.MaxStackTraceDepth {
+		log.StackTrace = truncateStackTrace(log.StackTrace, l.MaxStackTraceDepth)
+	}
+}
+
+// truncateValue returns the truncated text form of the value and true if the value exceeds MaxFieldValueLen.
+// The common scalar types never exceed the limit in practice, so they aren't formatted.
+func (l Limits) truncateValue(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "", false
+	case string:
+		s = v
+	case []byte:
+		if len(v) <= l.MaxFieldValueLen {
+			return "", false
+		}
+		s = string(v)
+	default:
+		s = fmt.Sprintf("%v", value)
+	}
+	if len(s) <= l.MaxFieldValueLen {
+		return "", false
+	}
+	n := truncateLen([]byte(s), l.MaxFieldValueLen)
+	return string(appendTruncated([]byte(s[:n]), len(s)-n)), true
+}
+
+// truncateLen returns the length of b truncated to max bytes at a UTF-8 boundary.
+func truncateLen(b []byte, max int) int {
+	n := max
+	for n > 0 && n < len(b) && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return n
+}
+
+// appendTruncated appends the truncation marker for n bytes to b.
+func appendTruncated(b []byte, n int) []byte {
+	b = append(b, "...[truncated "...)
+	b = strconv.AppendInt(b, int64(n), 10)
+	return append(b, " bytes]"...)
+}
+
+// truncateStackTrace returns a new stack trace which has at most depth frames. A program counter may expand to
+// several frames by inlining, so it removes the program counters until the frames fit.
+func truncateStackTrace(st *erf.StackTrace, depth int) *erf.StackTrace {
+	pc := st.PC()
+	if len(pc) > depth {
+		pc = pc[:depth]
+	}
+	for ; len(pc) > 0; pc = pc[:len(pc)-1] {
+		st2 := erf.NewStackTrace(pc...)
+		if st2.Len() <= depth {
+			return st2
+		}
+	}
+	return erf.NewStackTrace()
+}
+
+type limitOutput struct {
+	output Output
+	limits Limits
+}
+
+func (o *limitOutput) Log(log *Log) {
+	limited := o.limits.Apply(log)
+	log.Release()
+	o.output.Log(limited)
+}
+
+// TryLog is implementation of ErrorOutput.
+// It returns nil if the underlying output isn't an ErrorOutput.
+func (o *limitOutput) TryLog(log *Log) error {
+	limited := o.limits.Apply(log)
+	if output, ok := o.output.(ErrorOutput); ok {
+		defer limited.Release()
+		return output.TryLog(limited)
+	}
+	o.output.Log(limited)
+	return nil
+}
+
+// Flush is implementation of Flusher.
+func (o *limitOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, o.output)
+}
+
+// Close is implementation of Closer.
+func (o *limitOutput) Close() error {
+	return closeOutput(o.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (o *limitOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(o.output, f)
+}
+
+// LimitOutput creates an output that passes the logs limited by the given limits to the provided output. It can be
+// used for the outputs which encode the logs as JSON.
+func LimitOutput(output Output, limits Limits) Output {
+	return &limitOutput{
+		output: output,
+		limits: limits,
+	}
+}
@@ -0,0 +1,95 @@
+package xlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleTextOutput_SetLimits() {
+	output := xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity).SetLimits(xlog.Limits{MaxMessageLen: 10})
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	logger.Info("short.")
+	logger.Info("a very long message.")
+
+	// Output:
+	// INFO - short.
+	// INFO - a very lon...[truncated 10 bytes]
+}
+
+func TestLogger_SetLimits(t *testing.T) {
+	var logs []*xlog.Log
+	logger := xlog.New(&recordLogsOutput{logs: &logs}, xlog.SeverityInfo, 0).
+		SetStackTraceSeverity(xlog.SeverityInfo).
+		SetLimits(xlog.Limits{MaxMessageLen: 5, MaxFieldValueLen: 4, MaxFields: 3, MaxStackTraceDepth: 1})
+
+	logger.WithFieldKeyVals("a", "çççç", "b", []byte("123456"), "c", 3, "d", 4).Info("héllo world")
+
+	if len(logs) != 1 {
+		t.Fatalf("got %d logs", len(logs))
+	}
+	log := logs[0]
+	if got, want := string(log.Message), "héll...[truncated 7 bytes]"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	want := []xlog.Field{
+		{Key: "a", Value: "çç...[truncated 4 bytes]"},
+		{Key: "b", Value: "1234...[truncated 2 bytes]"},
+		{Key: "...", Value: "[truncated 2 fields]"},
+	}
+	if len(log.Fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", log.Fields, want)
+	}
+	for i := range want {
+		if log.Fields[i].Key != want[i].Key || log.Fields[i].Value != want[i].Value {
+			t.Errorf("field %d = %v, want %v", i, log.Fields[i], want[i])
+		}
+	}
+	if log.StackTrace == nil || log.StackTrace.Len() != 1 {
+		t.Errorf("unexpected stack trace %v", log.StackTrace)
+	}
+}
+
+func TestLimitOutput(t *testing.T) {
+	output := &jsonOutput{}
+	logger := xlog.New(xlog.LimitOutput(output, xlog.Limits{MaxFieldValueLen: 8}), xlog.SeverityInfo, 0)
+
+	body := strings.Repeat("x", 1000)
+	logger.WithFieldKeyVals("body", body).Info("request.")
+
+	var v struct {
+		Message string `json:"message"`
+		Fields  []struct {
+			Value string `json:"value"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(output.data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Message != "request." {
+		t.Errorf("message = %q", v.Message)
+	}
+	if len(v.Fields) != 1 || v.Fields[0].Value != "xxxxxxxx...[truncated 992 bytes]" {
+		t.Errorf("unexpected fields %+v", v.Fields)
+	}
+}
+
+func TestLimits_Apply(t *testing.T) {
+	var buf bytes.Buffer
+	shared := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagSeverity | xlog.FlagFields)
+	logger := xlog.New(xlog.MultiOutput(
+		xlog.NewTextOutput(&bytes.Buffer{}).SetLimits(xlog.Limits{MaxMessageLen: 1}),
+		shared,
+	), xlog.SeverityInfo, 0)
+
+	logger.Info("not truncated for the other outputs.")
+
+	if got, want := buf.String(), "INFO - not truncated for the other outputs.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -3,12 +3,21 @@ package xlog
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goinsane/erf"
 )
 
 // Log carries the log.
+//
+// A Log is read-only once it has been emitted to an Output, because the same Log may be shared by several Outputs.
+// An Output which needs to modify the Log must work on a copy created by Duplicate.
+//
+// A Log created by Logger is taken from a pool. Every Output that receives the Log may call Release when it has
+// finished with the Log, so that the Log can be reused by the next logs after the last release.
 type Log struct {
 	Message     []byte
 	Error       error
@@ -19,6 +28,60 @@ type Log struct {
 	StackCaller erf.StackCaller
 	StackTrace  *erf.StackTrace
 	Flags       Flag
+
+	template   string
+	errText    string
+	hasErrText bool
+	redactors  []*RedactOutput
+	pooled     bool
+	refs       int32
+}
+
+var logPool = &sync.Pool{
+	New: func() interface{} {
+		return &Log{
+			pooled: true,
+		}
+	},
+}
+
+// newLog gets an empty Log from the pool. The returned Log has one reference.
+func newLog() *Log {
+	l := logPool.Get().(*Log)
+	l.refs = 1
+	return l
+}
+
+// retain adds n references to the Log. Each reference must be released by calling Release.
+func (l *Log) retain(n int) {
+	if l == nil || !l.pooled {
+		return
+	}
+	atomic.AddInt32(&l.refs, int32(n))
+}
+
+// Release releases a reference of the Log. The caller must not use the Log after calling Release.
+// When the last reference is released, the Log is put back into the pool for reuse.
+// Release does nothing for a Log which isn't created by Logger or Log.Duplicate.
+func (l *Log) Release() {
+	if l == nil || !l.pooled {
+		return
+	}
+	if atomic.AddInt32(&l.refs, -1) > 0 {
+		return
+	}
+	if cap(l.Message) > maxPooledBufferSize {
+		l.Message = nil
+	}
+	for i := range l.Fields {
+		l.Fields[i] = Field{}
+	}
+	*l = Log{
+		Message: l.Message[:0],
+		Fields:  l.Fields[:0],
+		pooled:  true,
+	}
+	logPool.Put(l)
 }
 
 // Duplicate duplicates the Log.
@@ -26,24 +89,75 @@ func (l *Log) Duplicate() *Log {
 	if l == nil {
 		return nil
 	}
-	l2 := &Log{
-		Message:     nil,
-		Error:       l.Error,
-		Severity:    l.Severity,
-		Verbosity:   l.Verbosity,
-		Time:        l.Time,
-		Fields:      l.Fields.Duplicate(),
-		StackCaller: l.StackCaller,
-		StackTrace:  l.StackTrace.Duplicate(),
-		Flags:       l.Flags,
+	l2 := newLog()
+	l2.Error = l.Error
+	l2.Severity = l.Severity
+	l2.Verbosity = l.Verbosity
+	l2.Time = l.Time
+	l2.StackCaller = l.StackCaller
+	l2.StackTrace = l.StackTrace.Duplicate()
+	l2.Flags = l.Flags
+	l2.template = l.template
+	l2.errText = l.errText
+	l2.hasErrText = l.hasErrText
+	if l.redactors != nil {
+		l2.redactors = append([]*RedactOutput(nil), l.redactors...)
 	}
 	if l.Message != nil {
-		l2.Message = make([]byte, len(l.Message))
-		copy(l2.Message, l.Message)
+		l2.Message = append(l2.Message, l.Message...)
+	} else {
+		l2.Message = nil
+	}
+	if l.Fields != nil {
+		l2.Fields = append(l2.Fields, l.Fields...)
+	} else {
+		l2.Fields = nil
 	}
 	return l2
 }
 
+// ErrorText returns the text of the error of the Log. The Outputs like RedactOutput may change the error text
+// without replacing the error, so the Outputs should write the error text by ErrorText instead of Error.Error.
+// It returns empty string if the Log has no error.
+func (l *Log) ErrorText() string {
+	if l.hasErrText {
+		return l.errText
+	}
+	if l.Error == nil {
+		return ""
+	}
+	return l.Error.Error()
+}
+
+// setErrorText changes the error text of the Log without replacing the error.
+func (l *Log) setErrorText(text string) {
+	l.errText = text
+	l.hasErrText = true
+}
+
+// ErfStackTrace returns the stack trace of the error of the Log like fmt.Sprintf("%1.1x", err) if the error is
+// *erf.Erf. It writes the error texts by FlagErfMessage and the error fields by FlagErfFields in flags. The texts and
+// the fields which RedactOutput redacts are redacted in the stack trace as well.
+// It returns empty string if the error of the Log isn't *erf.Erf.
+func (l *Log) ErfStackTrace(flags Flag) string {
+	e, ok := l.Error.(*erf.Erf)
+	if !ok {
+		return ""
+	}
+	if len(l.redactors) > 0 {
+		return redactedErfStackTrace(e, flags, l.redactors)
+	}
+	format := "%"
+	if flags&FlagErfMessage == 0 {
+		format += "-"
+	}
+	if flags&FlagErfFields != 0 {
+		format += "+"
+	}
+	format += "1.1x"
+	return fmt.Sprintf(format, e)
+}
+
 // String is implementation of fmt.Stringer.
 func (l *Log) String() string {
 	return fmt.Sprintf("%s", l)
@@ -51,147 +165,263 @@ func (l *Log) String() string {
 
 // Format is implementation of fmt.Formatter.
 func (l *Log) Format(f fmt.State, verb rune) {
-	buf := bytes.NewBuffer(make([]byte, 0, 4096))
 	switch verb {
 	case 's', 'v':
-		if l.Flags&(FlagDate|FlagTime|FlagMicroseconds) != 0 {
-			tm := l.Time.Local()
-			if l.Flags&FlagUTC != 0 {
-				tm = tm.UTC()
-			}
-			b := make([]byte, 0, 128)
-			if l.Flags&FlagDate != 0 {
-				year, month, day := tm.Date()
-				itoa(&b, year, 4)
-				b = append(b, '/')
-				itoa(&b, int(month), 2)
-				b = append(b, '/')
-				itoa(&b, day, 2)
-				b = append(b, ' ')
-			}
-			if l.Flags&(FlagTime|FlagMicroseconds) != 0 {
-				hour, min, sec := tm.Clock()
-				itoa(&b, hour, 2)
-				b = append(b, ':')
-				itoa(&b, min, 2)
-				b = append(b, ':')
-				itoa(&b, sec, 2)
-				if l.Flags&FlagMicroseconds != 0 {
-					b = append(b, '.')
-					itoa(&b, l.Time.Nanosecond()/1e3, 6)
-				}
-				b = append(b, ' ')
-			}
-			buf.Write(b)
-		}
+		buf := getBuffer()
+		buf.b = l.appendText(buf.b, l.Flags, nil)
+		_, _ = f.Write(buf.b)
+		putBuffer(buf)
+	default:
+		return
+	}
+}
 
-		if l.Flags&FlagSeverity != 0 {
-			buf.WriteString(l.Severity.String())
-			buf.WriteString(" - ")
-		}
+// MarshalText is implementation of encoding.TextMarshaler.
+func (l *Log) MarshalText() (text []byte, err error) {
+	return l.appendText(nil, l.Flags, nil), nil
+}
 
-		var padding []byte
-		if l.Flags&FlagPadding != 0 {
-			padding = bytes.Repeat([]byte(" "), buf.Len())
+// appendText appends the text form of the Log to b by using the given flags instead of Log.Flags, and returns the
+// extended buffer. If tf is nil, it uses the default text format.
+func (l *Log) appendText(b []byte, flags Flag, tf *textFormat) []byte {
+	if tf == nil {
+		tf = &defaultTextFormat
+	}
+	start, invisible := len(b), 0
+	color := func(code string) {
+		if tf.color {
+			b = append(b, code...)
+			invisible += len(code)
 		}
+	}
 
-		if l.Flags&(FlagLongFunc|FlagShortFunc) != 0 {
-			fn := "???"
-			if l.StackCaller.Function != "" {
-				fn = trimSrcPath(l.StackCaller.Function)
-			}
-			if l.Flags&FlagShortFunc != 0 {
-				fn = trimDirs(fn)
-			}
-			buf.WriteString(fn)
-			buf.WriteString("()")
-			buf.WriteString(" - ")
+	if flags&(FlagDate|FlagTime|FlagMicroseconds) != 0 {
+		b = tf.time.appendTime(b, l.Time, flags)
+		b = append(b, ' ')
+	}
+
+	if flags&FlagSeverity != 0 {
+		color(severityColor(l.Severity))
+		b = append(b, l.Severity.String()...)
+		color(colorReset)
+		b = append(b, " - "...)
+	}
+
+	padding := 0
+	if flags&FlagPadding != 0 {
+		padding = len(b) - start - invisible
+	}
+
+	if flags&(FlagLongFunc|FlagShortFunc|FlagLongFile|FlagShortFile) != 0 {
+		color(colorDim)
+	}
+
+	if flags&(FlagLongFunc|FlagShortFunc) != 0 {
+		fn := "???"
+		if l.StackCaller.Function != "" {
+			fn = callerFunc(l.StackCaller.Function, l.StackCaller.File, tf.callerPath)
+		}
+		if flags&FlagShortFunc != 0 {
+			fn = trimDirs(fn)
 		}
+		b = append(b, fn...)
+		b = append(b, "()"...)
+		b = append(b, " - "...)
+	}
 
-		if l.Flags&(FlagLongFile|FlagShortFile) != 0 {
-			file, line := "???", 0
-			if l.StackCaller.File != "" {
-				file = trimSrcPath(l.StackCaller.File)
-				if l.Flags&FlagShortFile != 0 {
-					file = trimDirs(file)
-				}
-			}
-			if l.StackCaller.Line > 0 {
-				line = l.StackCaller.Line
+	if flags&(FlagLongFile|FlagShortFile) != 0 {
+		file, line := "???", 0
+		if l.StackCaller.File != "" {
+			file = callerPath(l.StackCaller.File, l.StackCaller.Function, tf.callerPath)
+			if flags&FlagShortFile != 0 {
+				file = trimDirs(file)
 			}
-			buf.WriteString(file)
-			buf.WriteRune(':')
-			b := make([]byte, 0, 128)
-			itoa(&b, line, -1)
-			buf.Write(b)
-			buf.WriteString(" - ")
 		}
+		if l.StackCaller.Line > 0 {
+			line = l.StackCaller.Line
+		}
+		b = append(b, file...)
+		b = append(b, ':')
+		itoa(&b, line, -1)
+		b = append(b, " - "...)
+	}
 
-		for idx, line := range bytes.Split(l.Message, []byte("\n")) {
-			if idx > 0 {
-				buf.Write(padding)
-			}
-			buf.Write(line)
-			buf.WriteRune('\n')
+	if flags&(FlagLongFunc|FlagShortFunc|FlagLongFile|FlagShortFile) != 0 {
+		color(colorReset)
+	}
+
+	for msg := l.Message; ; {
+		idx := bytes.IndexByte(msg, '\n')
+		if idx < 0 || tf.escape == EscapeStrict {
+			b = appendEscapedBytes(b, msg, tf.escape)
+			b = append(b, '\n')
+			break
 		}
+		b = appendEscapedBytes(b, msg[:idx], tf.escape)
+		b = append(b, '\n')
+		b = appendRepeat(b, ' ', padding)
+		msg = msg[idx+1:]
+	}
 
-		extended := false
-		extend := func() {
-			if !extended {
-				extended = true
-				buf.WriteString("\t\n")
-			}
+	extended := false
+	extend := func() {
+		if !extended {
+			extended = true
+			b = append(b, "\t\n"...)
 		}
-		erfError, _ := l.Error.(*erf.Erf)
+	}
+	erfError, _ := l.Error.(*erf.Erf)
 
-		if l.Flags&FlagFields != 0 && len(l.Fields) > 0 {
-			extend()
-			buf.WriteRune('\t')
-			buf.WriteString("+ ")
-			for idx, field := range l.Fields {
+	if flags&FlagFields != 0 && len(l.Fields) > 0 {
+		extend()
+		if tf.alignFields {
+			b = l.appendAlignedFields(b, tf)
+		} else {
+			b = append(b, "\t+ "...)
+			for idx := range l.Fields {
+				field := &l.Fields[idx]
 				if idx > 0 {
-					buf.WriteRune(' ')
-				}
-				mark := ""
-				if field.mark != nil {
-					mark = fmt.Sprintf("%v", field.mark)
+					b = append(b, ' ')
 				}
-				buf.WriteString(fmt.Sprintf("%s%q=%q", mark, field.Key, fmt.Sprintf("%v", field.Value)))
+				color(colorKey)
+				b = field.appendKey(b)
+				color(colorReset)
+				b = append(b, '=')
+				b = appendQuotedValue(b, field.Value)
 			}
-			buf.WriteString("\n\t")
-			buf.WriteRune('\n')
+			b = append(b, '\n')
 		}
+		b = append(b, "\t\n"...)
+	}
 
-		if l.Flags&FlagStackTrace != 0 && l.StackTrace != nil {
-			extend()
-			buf.WriteString(fmt.Sprintf("%+1.1s", l.StackTrace))
-			buf.WriteString("\n\t")
-			buf.WriteRune('\n')
+	if flags&FlagStackTrace != 0 && l.StackTrace != nil {
+		extend()
+		color(colorDim)
+		b = appendStackTrace(b, l.StackTrace, tf.callerPath)
+		color(colorReset)
+		b = append(b, "\n\t\n"...)
+	}
+
+	if flags&FlagErfStackTrace != 0 && erfError != nil {
+		extend()
+		color(colorDim)
+		erfEscape := tf.escape
+		if erfEscape == EscapeStrict {
+			erfEscape = EscapeControl
 		}
+		b = appendEscaped(b, l.ErfStackTrace(flags), erfEscape)
+		color(colorReset)
+		b = append(b, '\n')
+	}
 
-		if l.Flags&FlagErfStackTrace != 0 && erfError != nil {
-			extend()
-			format := "%"
-			if l.Flags&FlagErfMessage == 0 {
-				format += "-"
-			}
-			if l.Flags&FlagErfFields != 0 {
-				format += "+"
-			}
-			format += "1.1x"
-			buf.WriteString(fmt.Sprintf(format, erfError))
-			buf.WriteRune('\n')
+	return b
+}
+
+// appendAlignedFields appends the fields of the Log one per line by aligning their values.
+func (l *Log) appendAlignedFields(b []byte, tf *textFormat) []byte {
+	width := 0
+	for idx := range l.Fields {
+		start := len(b)
+		b = l.Fields[idx].appendKey(b)
+		if w := len(b) - start; w > width {
+			width = w
+		}
+		b = b[:start]
+	}
+	for idx := range l.Fields {
+		b = append(b, "\t+ "...)
+		if tf.color {
+			b = append(b, colorKey...)
 		}
+		start := len(b)
+		b = l.Fields[idx].appendKey(b)
+		w := len(b) - start
+		if tf.color {
+			b = append(b, colorReset...)
+		}
+		b = appendRepeat(b, ' ', width-w)
+		b = append(b, " = "...)
+		b = appendQuotedValue(b, l.Fields[idx].Value)
+		b = append(b, '\n')
+	}
+	return b
+}
 
+// appendFlagTime appends the date and the time of tm to b by the date and time flags.
+func appendFlagTime(b []byte, tm time.Time, flags Flag) []byte {
+	if flags&FlagDate != 0 {
+		year, month, day := tm.Date()
+		itoa(&b, year, 4)
+		b = append(b, '/')
+		itoa(&b, int(month), 2)
+		b = append(b, '/')
+		itoa(&b, day, 2)
+		if flags&(FlagTime|FlagMicroseconds) != 0 {
+			b = append(b, ' ')
+		}
+	}
+	if flags&(FlagTime|FlagMicroseconds) != 0 {
+		hour, min, sec := tm.Clock()
+		itoa(&b, hour, 2)
+		b = append(b, ':')
+		itoa(&b, min, 2)
+		b = append(b, ':')
+		itoa(&b, sec, 2)
+		if flags&FlagMicroseconds != 0 {
+			b = append(b, '.')
+			itoa(&b, tm.Nanosecond()/1e3, 6)
+		}
+	}
+	return b
+}
+
+// appendQuotedValue appends the double-quoted form of fmt.Sprintf("%v", value) to b without formatting for the
+// common scalar types.
+func appendQuotedValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return strconv.AppendQuote(b, v)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		b = append(b, '"')
+		b = appendValue(b, v)
+		return append(b, '"')
 	default:
-		return
+		return strconv.AppendQuote(b, fmt.Sprintf("%v", value))
 	}
-	_, _ = f.Write(buf.Bytes())
 }
 
-// MarshalText is implementation of encoding.TextMarshaler.
-func (l *Log) MarshalText() (text []byte, err error) {
-	f := &fmtState{}
-	l.Format(f, 's')
-	return f.Buffer, nil
+// appendValue appends the form of fmt.Sprintf("%v", value) to b without formatting for the common scalar types.
+func appendValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return append(b, v...)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case float32:
+		return strconv.AppendFloat(b, float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(b, v, 'g', -1, 64)
+	default:
+		return append(b, fmt.Sprintf("%v", value)...)
+	}
 }
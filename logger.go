@@ -1,17 +1,27 @@
 package xlog
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/goinsane/erf"
 )
 
 // Logger provides a logger for leveled and structured logging.
 type Logger struct {
-	mu                 sync.RWMutex
+	mu     sync.Mutex
+	config unsafe.Pointer
+}
+
+// loggerConfig is an immutable snapshot of the Logger configuration.
+// The Logger replaces its snapshot on every change instead of modifying it.
+type loggerConfig struct {
 	output             Output
 	severity           Severity
 	verbose            Verbose
@@ -23,6 +33,9 @@ type Logger struct {
 	time               time.Time
 	fields             Fields
 	erfStackTrace      bool
+	exitFunc           func(code int)
+	fatalTimeout       time.Duration
+	limits             Limits
 }
 
 // New creates a new Logger. If severity is invalid, it sets SeverityInfo.
@@ -30,67 +43,98 @@ func New(output Output, severity Severity, verbose Verbose) *Logger {
 	if !severity.IsValid() {
 		severity = SeverityInfo
 	}
-	return &Logger{
+	return newLogger(&loggerConfig{
 		output:             output,
 		severity:           severity,
 		verbose:            verbose,
 		flags:              FlagDefault,
 		printSeverity:      SeverityInfo,
 		stackTraceSeverity: SeverityNone,
+		fatalTimeout:       defaultFatalTimeout,
+	})
+}
+
+func newLogger(c *loggerConfig) *Logger {
+	return &Logger{
+		config: unsafe.Pointer(c),
 	}
 }
 
+// zeroConfig is the configuration of the zero value Logger which has no output.
+var zeroConfig = &loggerConfig{}
+
+// loadConfig returns the current configuration snapshot of the Logger.
+// If the Logger is the zero value, it returns zeroConfig.
+func (l *Logger) loadConfig() *loggerConfig {
+	if c := (*loggerConfig)(atomic.LoadPointer(&l.config)); c != nil {
+		return c
+	}
+	return zeroConfig
+}
+
+// updateConfig replaces the configuration snapshot of the Logger by a modified copy.
+func (l *Logger) updateConfig(f func(c *loggerConfig)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := *l.loadConfig()
+	f(&c)
+	atomic.StorePointer(&l.config, unsafe.Pointer(&c))
+}
+
+// derive creates a new Logger with a modified copy of the configuration snapshot of the Logger.
+func (l *Logger) derive(f func(c *loggerConfig)) *Logger {
+	c := *l.loadConfig()
+	c.erfStackTrace = false
+	if f != nil {
+		f(&c)
+	}
+	return newLogger(&c)
+}
+
 // Duplicate duplicates the Logger.
 func (l *Logger) Duplicate() *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	l2 := &Logger{
-		output:             l.output,
-		severity:           l.severity,
-		verbose:            l.verbose,
-		printSeverity:      l.printSeverity,
-		stackTraceSeverity: l.stackTraceSeverity,
-		prefix:             l.prefix,
-		verbosity:          l.verbosity,
-		time:               l.time,
-		fields:             l.fields.Duplicate(),
-		flags:              l.flags,
+	return l.derive(nil)
+}
+
+// isEnabled returns whether the Logger logs the logs with the given severity.
+func (l *Logger) isEnabled(severity Severity) bool {
+	if l == nil {
+		return false
 	}
-	return l2
+	c := l.loadConfig()
+	return c.output != nil && c.severity.rank() >= severity.rank() && c.verbose >= c.verbosity
 }
 
-func (l *Logger) out(severity Severity, message string, err error) {
+// out emits a new Log to the output. The argument template is the format of the message if there is.
+func (l *Logger) out(severity Severity, template string, message []byte, err error) {
 	if l == nil {
 		return
 	}
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	if l.output != nil && l.severity >= severity && l.verbose >= l.verbosity {
-		messageLen := len(l.prefix) + len(message)
-		log := &Log{
-			Message:   make([]byte, 0, messageLen),
-			Error:     err,
-			Severity:  severity,
-			Verbosity: l.verbosity,
-			Time:      l.time,
-			Fields:    l.fields.Duplicate(),
-			Flags:     l.flags,
-		}
-		log.Message = append(log.Message, l.prefix...)
+	c := l.loadConfig()
+	if c.output != nil && c.severity.rank() >= severity.rank() && c.verbose >= c.verbosity {
+		log := newLog()
+		log.Message = append(log.Message, c.prefix...)
 		log.Message = append(log.Message, message...)
-		if messageLen != 0 && log.Message[messageLen-1] == '\n' {
+		if messageLen := len(log.Message); messageLen != 0 && log.Message[messageLen-1] == '\n' {
 			log.Message = log.Message[:messageLen-1]
 		}
+		log.Error = err
+		log.Severity = severity
+		log.Verbosity = c.verbosity
+		log.Time = c.time
+		log.Fields = append(log.Fields, c.fields...)
+		log.Flags = c.flags
+		log.template = template
 		if log.Time.IsZero() {
 			log.Time = time.Now()
 		}
-		if e, ok := log.Error.(*erf.Erf); ok && l.erfStackTrace {
+		if e, ok := log.Error.(*erf.Erf); ok && c.erfStackTrace {
 			stackTrace := e.StackTrace()
 			log.StackCaller = stackTrace.Caller(0)
-			if l.stackTraceSeverity >= severity {
+			if c.stackTraceSeverity.rank() >= severity.rank() {
 				log.StackTrace = e.StackTrace()
 			}
 			/*e2 := e.Unwrap()
@@ -101,16 +145,26 @@ func (l *Logger) out(severity Severity, message string, err error) {
 			}*/
 			log.Error = e.CopyByTop(e.PCLen())
 		} else {
-			log.StackCaller = erf.NewStackTrace(erf.PC(1, 5)...).Caller(0)
-			if l.stackTraceSeverity >= severity {
+			log.StackCaller = callerOf(3)
+			if c.stackTraceSeverity.rank() >= severity.rank() {
 				log.StackTrace = erf.NewStackTrace(erf.PC(defaultPCSize, 5)...)
 			}
 		}
-		l.output.Log(log)
+		if !c.limits.IsZero() && c.limits.Exceeds(log) {
+			c.limits.truncate(log)
+		}
+		// the Logger holds its own reference until the output returns, so the Outputs which use the Log after
+		// passing it to another Output don't see a reused Log.
+		log.retain(1)
+		c.output.Log(log)
+		log.Release()
 	}
 }
 
 func (l *Logger) log(severity Severity, args ...interface{}) {
+	if !l.isEnabled(severity) {
+		return
+	}
 	var err error
 	for _, arg := range args {
 		if e, ok := arg.(error); ok {
@@ -118,19 +172,31 @@ func (l *Logger) log(severity Severity, args ...interface{}) {
 			break
 		}
 	}
-	l.out(severity, fmt.Sprint(args...), err)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, _ = fmt.Fprint(buf, args...)
+	l.out(severity, "", buf.b, err)
 }
 
 func (l *Logger) logf(severity Severity, format string, args ...interface{}) {
+	if !l.isEnabled(severity) {
+		return
+	}
 	var err error
 	wErr := fmt.Errorf(format, args...)
 	if e, ok := wErr.(erf.WrappedError); ok {
 		err = e.Unwrap()
 	}
-	l.out(severity, wErr.Error(), err)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.b = append(buf.b, wErr.Error()...)
+	l.out(severity, format, buf.b, err)
 }
 
 func (l *Logger) logln(severity Severity, args ...interface{}) {
+	if !l.isEnabled(severity) {
+		return
+	}
 	var err error
 	for _, arg := range args {
 		if e, ok := arg.(error); ok {
@@ -138,25 +204,46 @@ func (l *Logger) logln(severity Severity, args ...interface{}) {
 			break
 		}
 	}
-	l.out(severity, fmt.Sprintln(args...), err)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, _ = fmt.Fprintln(buf, args...)
+	l.out(severity, "", buf.b, err)
 }
 
-// Fatal logs to the FATAL severity logs, then calls os.Exit(1).
+// Fatal logs to the FATAL severity logs, flushes and closes the output, then calls the exit function with code 1.
 func (l *Logger) Fatal(args ...interface{}) {
 	l.log(SeverityFatal, args...)
-	os.Exit(1)
+	l.exit()
 }
 
-// Fatalf logs to the FATAL severity logs, then calls os.Exit(1).
+// Fatalf logs to the FATAL severity logs, flushes and closes the output, then calls the exit function with code 1.
 func (l *Logger) Fatalf(format string, args ...interface{}) {
 	l.logf(SeverityFatal, format, args...)
-	os.Exit(1)
+	l.exit()
 }
 
-// Fatalln logs to the FATAL severity logs, then calls os.Exit(1).
+// Fatalln logs to the FATAL severity logs, flushes and closes the output, then calls the exit function with code 1.
 func (l *Logger) Fatalln(args ...interface{}) {
 	l.logln(SeverityFatal, args...)
-	os.Exit(1)
+	l.exit()
+}
+
+// Panic creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs, then panics with the new
+// *erf.Erf.
+func (l *Logger) Panic(args ...interface{}) {
+	panic(l.logPanic(erf.New(fmt.Sprint(args...)).CopyByTop(1)))
+}
+
+// Panicf creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs, then panics with the new
+// *erf.Erf.
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	panic(l.logPanic(erf.Newf(format, args...).CopyByTop(1)))
+}
+
+// Panicln creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs, then panics with the new
+// *erf.Erf.
+func (l *Logger) Panicln(args ...interface{}) {
+	panic(l.logPanic(erf.New(strings.TrimSuffix(fmt.Sprintln(args...), "\n")).CopyByTop(1)))
 }
 
 // Error logs to the ERROR severity logs.
@@ -224,7 +311,7 @@ func (l *Logger) Print(args ...interface{}) {
 	if l == nil {
 		return
 	}
-	l.log(l.printSeverity, args...)
+	l.log(l.loadConfig().printSeverity, args...)
 }
 
 // Printf logs a log which has the Logger's print severity.
@@ -232,7 +319,7 @@ func (l *Logger) Printf(format string, args ...interface{}) {
 	if l == nil {
 		return
 	}
-	l.logf(l.printSeverity, format, args...)
+	l.logf(l.loadConfig().printSeverity, format, args...)
 }
 
 // Println logs a log which has the Logger's print severity.
@@ -240,7 +327,51 @@ func (l *Logger) Println(args ...interface{}) {
 	if l == nil {
 		return
 	}
-	l.logln(l.printSeverity, args...)
+	l.logln(l.loadConfig().printSeverity, args...)
+}
+
+// SetExitFunc sets the function which Fatal methods call after flushing and closing the output.
+// If f is nil, it sets os.Exit.
+// It returns underlying Logger.
+// By default, os.Exit.
+func (l *Logger) SetExitFunc(f func(code int)) *Logger {
+	if l == nil {
+		return nil
+	}
+	l.updateConfig(func(c *loggerConfig) {
+		c.exitFunc = f
+	})
+	return l
+}
+
+// SetLimits sets the size limits of the logs.
+// It returns underlying Logger.
+// By default, unlimited.
+func (l *Logger) SetLimits(limits Limits) *Logger {
+	if l == nil {
+		return nil
+	}
+	l.updateConfig(func(c *loggerConfig) {
+		c.limits = limits
+	})
+	return l
+}
+
+// SetFatalTimeout sets the timeout of flushing and closing the output in Fatal methods.
+// If fatalTimeout is 0 or less, it sets the default.
+// It returns underlying Logger.
+// By default, 5s.
+func (l *Logger) SetFatalTimeout(fatalTimeout time.Duration) *Logger {
+	if l == nil {
+		return nil
+	}
+	if fatalTimeout <= 0 {
+		fatalTimeout = defaultFatalTimeout
+	}
+	l.updateConfig(func(c *loggerConfig) {
+		c.fatalTimeout = fatalTimeout
+	})
+	return l
 }
 
 // SetOutput sets the Logger's output.
@@ -249,9 +380,9 @@ func (l *Logger) SetOutput(output Output) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.output = output
+	l.updateConfig(func(c *loggerConfig) {
+		c.output = output
+	})
 	return l
 }
 
@@ -262,12 +393,12 @@ func (l *Logger) SetSeverity(severity Severity) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	if !severity.IsValid() {
 		severity = SeverityInfo
 	}
-	l.severity = severity
+	l.updateConfig(func(c *loggerConfig) {
+		c.severity = severity
+	})
 	return l
 }
 
@@ -277,9 +408,9 @@ func (l *Logger) SetVerbose(verbose Verbose) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.verbose = verbose
+	l.updateConfig(func(c *loggerConfig) {
+		c.verbose = verbose
+	})
 	return l
 }
 
@@ -291,9 +422,9 @@ func (l *Logger) SetFlags(flags Flag) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.flags = flags
+	l.updateConfig(func(c *loggerConfig) {
+		c.flags = flags
+	})
 	return l
 }
 
@@ -305,12 +436,12 @@ func (l *Logger) SetPrintSeverity(printSeverity Severity) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	if !printSeverity.IsValid() {
 		printSeverity = SeverityInfo
 	}
-	l.printSeverity = printSeverity
+	l.updateConfig(func(c *loggerConfig) {
+		c.printSeverity = printSeverity
+	})
 	return l
 }
 
@@ -322,12 +453,12 @@ func (l *Logger) SetStackTraceSeverity(stackTraceSeverity Severity) *Logger {
 	if l == nil {
 		return nil
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	if !stackTraceSeverity.IsValid() {
 		stackTraceSeverity = SeverityNone
 	}
-	l.stackTraceSeverity = stackTraceSeverity
+	l.updateConfig(func(c *loggerConfig) {
+		c.stackTraceSeverity = stackTraceSeverity
+	})
 	return l
 }
 
@@ -336,12 +467,12 @@ func (l *Logger) V(verbosity Verbose) *Logger {
 	if l == nil {
 		return nil
 	}
-	if !(l.verbose >= verbosity) {
+	if !(l.loadConfig().verbose >= verbosity) {
 		return nil
 	}
-	l2 := l.Duplicate()
-	l2.verbosity = verbosity
-	return l2
+	return l.derive(func(c *loggerConfig) {
+		c.verbosity = verbosity
+	})
 }
 
 // WithPrefix duplicates the Logger and adds given prefix to end of the underlying prefix.
@@ -349,9 +480,10 @@ func (l *Logger) WithPrefix(args ...interface{}) *Logger {
 	if l == nil {
 		return nil
 	}
-	l2 := l.Duplicate()
-	l2.prefix += fmt.Sprint(args...) + ": "
-	return l2
+	prefix := fmt.Sprint(args...) + ": "
+	return l.derive(func(c *loggerConfig) {
+		c.prefix += prefix
+	})
 }
 
 // WithPrefixf duplicates the Logger and adds given prefix to end of the underlying prefix.
@@ -359,9 +491,10 @@ func (l *Logger) WithPrefixf(format string, args ...interface{}) *Logger {
 	if l == nil {
 		return nil
 	}
-	l2 := l.Duplicate()
-	l2.prefix += fmt.Sprintf(format, args...) + ": "
-	return l2
+	prefix := fmt.Sprintf(format, args...) + ": "
+	return l.derive(func(c *loggerConfig) {
+		c.prefix += prefix
+	})
 }
 
 // WithTime duplicates the Logger with given time.
@@ -369,9 +502,9 @@ func (l *Logger) WithTime(tm time.Time) *Logger {
 	if l == nil {
 		return nil
 	}
-	l2 := l.Duplicate()
-	l2.time = tm
-	return l2
+	return l.derive(func(c *loggerConfig) {
+		c.time = tm
+	})
 }
 
 // WithFields duplicates the Logger with given fields.
@@ -379,9 +512,9 @@ func (l *Logger) WithFields(fields ...Field) *Logger {
 	if l == nil {
 		return nil
 	}
-	l2 := l.Duplicate()
-	l2.fields = append(l2.fields, fields...)
-	return l2
+	return l.derive(func(c *loggerConfig) {
+		c.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	})
 }
 
 // WithFieldKeyVals duplicates the Logger with given key and values of Field.
@@ -454,6 +587,44 @@ func (l *Logger) erfErrorf(severity Severity, format string, args ...interface{}
 	return result
 }
 
+// exit flushes and closes the output in the fatal timeout, then calls the exit function with code 1.
+func (l *Logger) exit() {
+	if l == nil {
+		os.Exit(1)
+		return
+	}
+	c := l.loadConfig()
+	if c.output != nil {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), c.fatalTimeout)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = flushOutput(ctx, c.output)
+			_ = closeOutput(c.output)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		ctxCancel()
+	}
+	exitFunc := c.exitFunc
+	if exitFunc == nil {
+		exitFunc = os.Exit
+	}
+	exitFunc(1)
+}
+
+// logPanic logs the given *erf.Erf to the PANIC severity logs, and returns it.
+func (l *Logger) logPanic(e *erf.Erf) *erf.Erf {
+	result := &loggerErfResult{
+		l: l.Duplicate(),
+		s: SeverityPanic,
+		e: e,
+	}
+	return result.Log()
+}
+
 type loggerErfResult struct {
 	l *Logger
 	s Severity
@@ -472,12 +643,12 @@ func (r *loggerErfResult) Log() *erf.Erf {
 	if r.l == nil {
 		return r.e
 	}
-	r.l.erfStackTrace = true
+	var fields Fields
 	for idx, e := range r.e.UnwrapAll() {
 		if e2, ok := e.(*erf.Erf); ok {
 			for _, tag := range e2.Tags() {
 				tagIdx := e2.TagIndex(tag)
-				r.l.fields = append(r.l.fields, Field{
+				fields = append(fields, Field{
 					Key:   tag,
 					Value: e2.Arg(tagIdx),
 					mark: &FieldMarkErf{
@@ -488,6 +659,10 @@ func (r *loggerErfResult) Log() *erf.Erf {
 			}
 		}
 	}
+	r.l.updateConfig(func(c *loggerConfig) {
+		c.erfStackTrace = true
+		c.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	})
 	r.l.log(r.s, r.e)
 	return r.e
 }
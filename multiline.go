@@ -0,0 +1,216 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// MultiLinePolicy defines how an Output handles the multi-line messages and the multi-line error texts.
+type MultiLinePolicy int
+
+const (
+	// MultiLineKeep keeps the messages and the error texts as they are. TextOutput indents the continuation lines of
+	// the messages by FlagPadding.
+	MultiLineKeep MultiLinePolicy = iota
+
+	// MultiLineIndent indents the continuation lines by a tab. A CRLF is treated as a single newline.
+	MultiLineIndent
+
+	// MultiLineEscape escapes the newlines and the carriage returns as `\n` and `\r`, so every text has a single line.
+	MultiLineEscape
+
+	// MultiLineSplit splits the message into separate Logs, one per line. The Logs are linked by the fields
+	// "multiline_id" which has the shared ID, "multiline_part" which is the 1-based line number, and
+	// "multiline_parts" which is the number of the lines. The error is kept only on the first Log, and its text is
+	// escaped like MultiLineEscape.
+	MultiLineSplit
+
+	// MultiLineFull keeps the first line of the message, and moves the whole message into the field "full_message"
+	// that gelfoutput writes as the GELF full_message. The first line of the error text is kept as the error text, and
+	// the whole error text is appended to the field.
+	MultiLineFull
+)
+
+// FullMessageKey is the key of the field that MultiLineFull moves the multi-line texts into.
+const FullMessageKey = "full_message"
+
+// String is implementation of fmt.Stringer.
+func (p MultiLinePolicy) String() string {
+	switch p {
+	case MultiLineKeep:
+		return "keep"
+	case MultiLineIndent:
+		return "indent"
+	case MultiLineEscape:
+		return "escape"
+	case MultiLineSplit:
+		return "split"
+	case MultiLineFull:
+		return "full"
+	default:
+		return "unknown"
+	}
+}
+
+// Apply applies the policy to the Log, and calls emit for every resulting Log in order. If the Log has neither a
+// multi-line message nor a multi-line error text, or the policy is MultiLineKeep, it calls emit with the given Log by
+// a new reference. The caller keeps its reference of the given Log, and emit takes the references of the resulting
+// Logs. The errors are kept, and their changed texts are available by Log.ErrorText.
+func (p MultiLinePolicy) Apply(log *Log, emit func(log *Log)) {
+	errText := log.ErrorText()
+	if p == MultiLineKeep || !isMultiLine(log.Message) && !isMultiLineString(errText) {
+		log.retain(1)
+		emit(log)
+		return
+	}
+
+	switch p {
+	case MultiLineIndent:
+		log = log.Duplicate()
+		log.Message = replaceNewlines(log.Message, "\n\t", "\n\t", "\n\t")
+		setMultiLineErrorText(log, errText, "\n\t", "\n\t", "\n\t")
+		emit(log)
+
+	case MultiLineEscape:
+		log = log.Duplicate()
+		log.Message = replaceNewlines(log.Message, `\r\n`, `\n`, `\r`)
+		setMultiLineErrorText(log, errText, `\r\n`, `\n`, `\r`)
+		emit(log)
+
+	case MultiLineSplit:
+		lines := bytes.Split(log.Message, []byte("\n"))
+		id := newMultiLineID()
+		for i, line := range lines {
+			log2 := log.Duplicate()
+			log2.Message = append(log2.Message[:0], bytes.TrimSuffix(line, []byte("\r"))...)
+			if i == 0 {
+				setMultiLineErrorText(log2, errText, `\r\n`, `\n`, `\r`)
+			} else {
+				log2.Error = nil
+				log2.errText, log2.hasErrText = "", false
+			}
+			log2.Fields = append(log2.Fields,
+				Field{Key: "multiline_id", Value: id},
+				Field{Key: "multiline_part", Value: i + 1},
+				Field{Key: "multiline_parts", Value: len(lines)},
+			)
+			emit(log2)
+		}
+
+	case MultiLineFull:
+		log2 := log.Duplicate()
+		full := string(log.Message)
+		if idx := bytes.IndexAny(log2.Message, "\r\n"); idx >= 0 {
+			log2.Message = log2.Message[:idx]
+		}
+		if idx := strings.IndexAny(errText, "\r\n"); idx >= 0 {
+			full += "\n" + errText
+			log2.setErrorText(errText[:idx])
+		}
+		log2.Fields = append(log2.Fields, Field{Key: FullMessageKey, Value: full})
+		emit(log2)
+
+	default:
+		log.retain(1)
+		emit(log)
+	}
+}
+
+// setMultiLineErrorText changes the error text of the Log to the text whose newlines are replaced, if the text is
+// multi-line.
+func setMultiLineErrorText(log *Log, text string, crlf, lf, cr string) {
+	if isMultiLineString(text) {
+		log.setErrorText(string(replaceNewlines([]byte(text), crlf, lf, cr)))
+	}
+}
+
+// replaceNewlines replaces the CRLFs in b with crlf, the other newlines with lf and the other carriage returns with cr
+// in place of b's buffer.
+func replaceNewlines(b []byte, crlf, lf, cr string) []byte {
+	src := append([]byte(nil), b...)
+	b = b[:0]
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\r' && i+1 < len(src) && src[i+1] == '\n':
+			b = append(b, crlf...)
+			i++
+		case c == '\n':
+			b = append(b, lf...)
+		case c == '\r':
+			b = append(b, cr...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func isMultiLine(b []byte) bool {
+	return bytes.IndexAny(b, "\r\n") >= 0
+}
+
+func isMultiLineString(s string) bool {
+	return strings.IndexAny(s, "\r\n") >= 0
+}
+
+// newMultiLineID returns a new random ID to link the Logs split by MultiLineSplit.
+func newMultiLineID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+type multiLineOutput struct {
+	output Output
+	policy MultiLinePolicy
+}
+
+func (o *multiLineOutput) Log(log *Log) {
+	o.policy.Apply(log, o.output.Log)
+	log.Release()
+}
+
+// TryLog is implementation of ErrorOutput.
+// It returns the first error of the resulting logs. It returns nil if the underlying output isn't an ErrorOutput.
+func (o *multiLineOutput) TryLog(log *Log) error {
+	output, ok := o.output.(ErrorOutput)
+	if !ok {
+		o.policy.Apply(log, o.output.Log)
+		return nil
+	}
+	var err error
+	o.policy.Apply(log, func(log *Log) {
+		if e := output.TryLog(log); e != nil && err == nil {
+			err = e
+		}
+		log.Release()
+	})
+	return err
+}
+
+// Flush is implementation of Flusher.
+func (o *multiLineOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, o.output)
+}
+
+// Close is implementation of Closer.
+func (o *multiLineOutput) Close() error {
+	return closeOutput(o.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (o *multiLineOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(o.output, f)
+}
+
+// MultiLineOutput creates an output that passes the logs handled by the given multi-line policy to the provided
+// output.
+func MultiLineOutput(output Output, policy MultiLinePolicy) Output {
+	return &multiLineOutput{
+		output: output,
+		policy: policy,
+	}
+}
@@ -0,0 +1,127 @@
+package xlog_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goinsane/erf"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleMultiLineOutput() {
+	output := xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity)
+	logger := xlog.New(xlog.MultiLineOutput(output, xlog.MultiLineEscape), xlog.SeverityInfo, 0)
+
+	logger.Info("first line\nsecond line")
+
+	// Output:
+	// INFO - first line\nsecond line
+}
+
+func TestMultiLinePolicy_Apply(t *testing.T) {
+	cause := errors.New("line 1\nline 2")
+	tests := []struct {
+		policy   xlog.MultiLinePolicy
+		messages []string
+		errors   []string
+	}{
+		{xlog.MultiLineKeep, []string{"a\nb"}, []string{"line 1\nline 2"}},
+		{xlog.MultiLineIndent, []string{"a\n\tb"}, []string{"line 1\n\tline 2"}},
+		{xlog.MultiLineEscape, []string{`a\nb`}, []string{`line 1\nline 2`}},
+		{xlog.MultiLineSplit, []string{"a", "b"}, []string{`line 1\nline 2`, ""}},
+		{xlog.MultiLineFull, []string{"a"}, []string{"line 1"}},
+	}
+	for _, tt := range tests {
+		var logs []*xlog.Log
+		tt.policy.Apply(&xlog.Log{
+			Message: []byte("a\nb"),
+			Error:   cause,
+			Fields:  xlog.Fields{{Key: "k", Value: "v"}},
+		}, func(log *xlog.Log) {
+			logs = append(logs, log)
+		})
+
+		if len(logs) != len(tt.messages) {
+			t.Errorf("%v: got %d logs, want %d", tt.policy, len(logs), len(tt.messages))
+			continue
+		}
+		for i, log := range logs {
+			if got := string(log.Message); got != tt.messages[i] {
+				t.Errorf("%v: message %d = %q, want %q", tt.policy, i, got, tt.messages[i])
+			}
+			if log.Error != nil && log.Error != cause {
+				t.Errorf("%v: error %d isn't the cause", tt.policy, i)
+			}
+			if got := log.ErrorText(); got != tt.errors[i] {
+				t.Errorf("%v: error %d = %q, want %q", tt.policy, i, got, tt.errors[i])
+			}
+		}
+
+		switch tt.policy {
+		case xlog.MultiLineSplit:
+			id := logs[0].Fields[1].Value
+			for i, log := range logs {
+				want := fmt.Sprintf("[{k v <nil>} {multiline_id %v <nil>} {multiline_part %d <nil>} {multiline_parts 2 <nil>}]", id, i+1)
+				if got := fmt.Sprint(log.Fields); got != want {
+					t.Errorf("split: fields %d = %s, want %s", i, got, want)
+				}
+			}
+		case xlog.MultiLineFull:
+			want := "[{k v <nil>} {full_message a\nb\nline 1\nline 2 <nil>}]"
+			if got := fmt.Sprint(logs[0].Fields); got != want {
+				t.Errorf("full: fields = %q, want %q", got, want)
+			}
+		}
+	}
+}
+
+func TestMultiLinePolicy_crlf(t *testing.T) {
+	tests := []struct {
+		policy xlog.MultiLinePolicy
+		want   string
+	}{
+		{xlog.MultiLineIndent, "a\n\tb\n\tc"},
+		{xlog.MultiLineEscape, `a\r\nb\nc`},
+	}
+	for _, tt := range tests {
+		tt.policy.Apply(&xlog.Log{Message: []byte("a\r\nb\nc")}, func(log *xlog.Log) {
+			if got := string(log.Message); got != tt.want {
+				t.Errorf("%v: message = %q, want %q", tt.policy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiLineOutput_erf(t *testing.T) {
+	var buf bytes.Buffer
+	output := xlog.NewTextOutput(&buf).SetFlags(xlog.FlagErfStackTrace)
+	logger := xlog.New(xlog.MultiLineOutput(output, xlog.MultiLineEscape), xlog.SeverityInfo, 0)
+	logger.Error(erf.New("line 1\nline 2"))
+
+	if got := buf.String(); !strings.HasPrefix(got, `line 1\nline 2`+"\n") || !strings.Contains(got, "multiline_test.go:") {
+		t.Errorf("output %q has no erf stack trace", got)
+	}
+}
+
+func TestMultiLineOutput_TryLog(t *testing.T) {
+	output := &recordOutput{}
+	multiLine := xlog.MultiLineOutput(output, xlog.MultiLineSplit).(xlog.ErrorOutput)
+
+	if err := multiLine.TryLog(&xlog.Log{Message: []byte("a\nb")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := output.Messages(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	output.failing = true
+	if err := multiLine.TryLog(&xlog.Log{Message: []byte("c\nd")}); err == nil {
+		t.Error("expected error")
+	}
+}
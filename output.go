@@ -12,34 +12,73 @@ import (
 
 // Output is an interface for Logger output.
 // All the Output implementations must be safe for concurrency.
+//
+// The Log given to the Log method is read-only, and it may be shared with other Outputs.
+// The Output holds a reference of the Log. When the Output has finished with the Log, it may call Log.Release to
+// release the reference, and then it must not use the Log anymore. An Output that passes the Log to another Output
+// hands over the reference as well. Logger keeps its own reference until the Log method returns, so an Output can
+// still use the Log after passing it to another Output in the Log method. An Output which keeps the Log after the
+// Log method returns must not pass it to another Output before it has finished with the Log.
 type Output interface {
 	Log(log *Log)
 }
 
+// ErrorOutput is an interface for the Outputs which can report the error of writing a Log.
+type ErrorOutput interface {
+	Output
+
+	// TryLog writes the Log once like Log method, and returns the error if it fails.
+	// Unlike Log method, TryLog doesn't take the reference of the Log. The caller still holds it after TryLog returns,
+	// so it can try again.
+	TryLog(log *Log) error
+}
+
 type multiOutput []Output
 
 func (m multiOutput) Log(log *Log) {
+	log.retain(len(m))
 	for _, o := range m {
-		o.Log(log.Duplicate())
+		o.Log(log)
 	}
+	log.Release()
 }
 
-// MultiOutput creates an output that duplicates its logs to all the provided outputs.
-func MultiOutput(outputs ...Output) Output {
-	m := make(multiOutput, len(outputs))
-	copy(m, outputs)
-	return m
+// Flush is implementation of Flusher.
+// It flushes all the outputs, and returns the first error.
+func (m multiOutput) Flush(ctx context.Context) error {
+	var err error
+	for _, o := range m {
+		if e := flushOutput(ctx, o); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
-type asyncOutput struct{ Output }
+// Close is implementation of Closer.
+// It closes all the outputs, and returns the first error.
+func (m multiOutput) Close() error {
+	var err error
+	for _, o := range m {
+		if e := closeOutput(o); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
 
-func (a *asyncOutput) Log(log *Log) {
-	go a.Output.Log(log)
+// SetErrorReporter is implementation of ErrorReporter.
+func (m multiOutput) SetErrorReporter(f func(error)) {
+	for _, o := range m {
+		setErrorReporter(o, f)
+	}
 }
 
-// AsyncOutput creates an output that doesn't block its logs to the provided output.
-func AsyncOutput(output Output) Output {
-	return &asyncOutput{output}
+// MultiOutput creates an output that shares its logs with all the provided outputs.
+func MultiOutput(outputs ...Output) Output {
+	m := make(multiOutput, len(outputs))
+	copy(m, outputs)
+	return m
 }
 
 // QueuedOutput is intermediate Output implementation between Logger and given Output.
@@ -51,6 +90,9 @@ type QueuedOutput struct {
 	ctxCancel   context.CancelFunc
 	blocking    uint32
 	onQueueFull *func()
+	pendingMu   sync.Mutex
+	pending     int
+	idle        chan struct{}
 }
 
 // NewQueuedOutput creates QueuedOutput by given output.
@@ -61,18 +103,54 @@ func NewQueuedOutput(output Output, queueLen int) (q *QueuedOutput) {
 	q = &QueuedOutput{
 		output: output,
 		queue:  make(chan *Log, queueLen),
+		idle:   make(chan struct{}),
 	}
+	close(q.idle)
 	q.ctx, q.ctxCancel = context.WithCancel(context.Background())
 	go q.worker()
 	return
 }
 
-// Close closed QueuedOutput. Unused QueuedOutput must be closed for freeing resources.
+// Close closes QueuedOutput. It doesn't close the underlying output. The logs in the queue are dropped, Flush
+// should be called before to write them. Unused QueuedOutput must be closed for freeing resources.
 func (q *QueuedOutput) Close() error {
 	q.ctxCancel()
 	return nil
 }
 
+// closeAll closes QueuedOutput and the underlying output.
+func (q *QueuedOutput) closeAll() error {
+	_ = q.Close()
+	if q.output == nil {
+		return nil
+	}
+	return closeOutput(q.output)
+}
+
+// Flush is implementation of Flusher.
+// It waits until the logs in the queue are written, and then flushes the underlying output.
+func (q *QueuedOutput) Flush(ctx context.Context) error {
+	q.pendingMu.Lock()
+	idle := q.idle
+	q.pendingMu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+	}
+	if q.output == nil {
+		return nil
+	}
+	return flushOutput(ctx, q.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (q *QueuedOutput) SetErrorReporter(f func(error)) {
+	if q.output != nil {
+		setErrorReporter(q.output, f)
+	}
+}
+
 // Log is implementation of Output.
 // If blocking is true, Log method blocks execution until underlying output has finished execution.
 // Otherwise, Log method sends log to queue if queue is available. When queue is full, it tries to call OnQueueFull
@@ -80,9 +158,11 @@ func (q *QueuedOutput) Close() error {
 func (q *QueuedOutput) Log(log *Log) {
 	select {
 	case <-q.ctx.Done():
+		log.Release()
 		return
 	default:
 	}
+	q.addPending(1)
 	if q.blocking != 0 {
 		q.queue <- log
 		return
@@ -90,6 +170,8 @@ func (q *QueuedOutput) Log(log *Log) {
 	select {
 	case q.queue <- log:
 	default:
+		q.addPending(-1)
+		log.Release()
 		if q.onQueueFull != nil && *q.onQueueFull != nil {
 			(*q.onQueueFull)()
 		}
@@ -136,18 +218,38 @@ func (q *QueuedOutput) worker() {
 		case msg := <-q.queue:
 			if q.output != nil {
 				q.output.Log(msg)
+			} else {
+				msg.Release()
 			}
+			q.addPending(-1)
 		}
 	}
 }
 
+// addPending adds n to the number of the pending logs, and signals Flush when it reaches 0.
+func (q *QueuedOutput) addPending(n int) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+	if q.pending == 0 && n > 0 {
+		q.idle = make(chan struct{})
+	}
+	q.pending += n
+	if q.pending == 0 {
+		close(q.idle)
+	}
+}
+
 // TextOutput is an implementation of Output by writing texts to io.Writer w.
 type TextOutput struct {
-	mu      sync.Mutex
-	w       io.Writer
-	bw      *bufio.Writer
-	flags   Flag
-	onError *func(error)
+	mu        sync.Mutex
+	w         io.Writer
+	bw        *bufio.Writer
+	flags     Flag
+	colorMode ColorMode
+	tf        textFormat
+	layout    *Layout
+	limits    Limits
+	onError   *func(error)
 }
 
 // NewTextOutput creates a new TextOutput.
@@ -160,38 +262,63 @@ func NewTextOutput(w io.Writer) *TextOutput {
 
 // Log is implementation of Output.
 func (t *TextOutput) Log(log *Log) {
-	var err error
-	defer func() {
-		if err == nil || t.onError == nil || *t.onError == nil {
-			return
-		}
-		(*t.onError)(err)
-	}()
+	err := t.TryLog(log)
+	log.Release()
+	if err == nil || t.onError == nil || *t.onError == nil {
+		return
+	}
+	(*t.onError)(err)
+}
 
+// TryLog is implementation of ErrorOutput.
+func (t *TextOutput) TryLog(log *Log) (err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	defer func() {
-		e := t.bw.Flush()
-		if err == nil {
-			err = e
-		}
-	}()
-
+	flags := log.Flags
 	if t.flags != 0 {
-		log.Flags = t.flags
+		flags = t.flags
 	}
 
-	var text []byte
-	text, err = log.MarshalText()
-	if err != nil {
-		return
+	if !t.limits.IsZero() && t.limits.Exceeds(log) {
+		log = t.limits.Apply(log)
+		defer log.Release()
 	}
 
-	_, err = t.bw.Write(text)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if t.layout != nil {
+		buf.b = t.layout.appendLog(buf.b, log, flags, &t.tf)
+	} else {
+		buf.b = log.appendText(buf.b, flags, &t.tf)
+	}
+
+	_, err = t.bw.Write(buf.b)
+	if err == nil {
+		err = t.bw.Flush()
+	}
 	if err != nil {
-		return
+		t.bw.Reset(t.w)
 	}
+	return err
+}
+
+// Flush is implementation of Flusher.
+func (t *TextOutput) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bw.Flush()
+}
+
+// Close is implementation of Closer.
+// It flushes TextOutput, but doesn't close the underlying writer.
+func (t *TextOutput) Close() error {
+	return t.Flush(context.Background())
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (t *TextOutput) SetErrorReporter(f func(error)) {
+	t.SetOnError(f)
 }
 
 // SetWriter sets writer.
@@ -201,6 +328,7 @@ func (t *TextOutput) SetWriter(w io.Writer) *TextOutput {
 	defer t.mu.Unlock()
 	t.w = w
 	t.bw = bufio.NewWriter(w)
+	t.tf.color = resolveColor(t.colorMode, w)
 	return t
 }
 
@@ -214,6 +342,81 @@ func (t *TextOutput) SetFlags(flags Flag) *TextOutput {
 	return t
 }
 
+// SetLayout sets the layout to write the logs instead of the default text form. The flags except FlagUTC don't affect
+// the layout. If layout is nil, it sets the default text form.
+// It returns underlying TextOutput.
+// By default, nil.
+func (t *TextOutput) SetLayout(layout *Layout) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.layout = layout
+	return t
+}
+
+// SetTimeFormat sets the format of the time of the logs. The date and time flags still define whether the time is
+// written.
+// It returns underlying TextOutput.
+// By default, the zero value of TimeFormat.
+func (t *TextOutput) SetTimeFormat(timeFormat TimeFormat) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tf.time = timeFormat
+	return t
+}
+
+// SetCallerPathMode sets the mode to write the file paths of StackCaller and StackTrace.
+// It returns underlying TextOutput.
+// By default, CallerPathGopath.
+func (t *TextOutput) SetCallerPathMode(callerPathMode CallerPathMode) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tf.callerPath = callerPathMode
+	return t
+}
+
+// SetEscapeMode sets the mode to escape the messages, the error texts and the field values against log injection.
+// The field values in the fields block are always quoted.
+// It returns underlying TextOutput.
+// By default, EscapeNone.
+func (t *TextOutput) SetEscapeMode(escapeMode EscapeMode) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tf.escape = escapeMode
+	return t
+}
+
+// SetLimits sets the size limits of the logs to write.
+// It returns underlying TextOutput.
+// By default, unlimited.
+func (t *TextOutput) SetLimits(limits Limits) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+	return t
+}
+
+// SetColorMode sets the color mode to colorize the severities, the fields, StackCaller and the stack traces.
+// ColorAuto is resolved by the current writer, and again when the writer is changed.
+// It returns underlying TextOutput.
+// By default, ColorNever.
+func (t *TextOutput) SetColorMode(colorMode ColorMode) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.colorMode = colorMode
+	t.tf.color = resolveColor(colorMode, t.w)
+	return t
+}
+
+// SetAlignFields sets whether to write the fields one per line by aligning their values.
+// It returns underlying TextOutput.
+// By default, false.
+func (t *TextOutput) SetAlignFields(alignFields bool) *TextOutput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tf.alignFields = alignFields
+	return t
+}
+
 // SetOnError sets a function to call when error occurs.
 // It returns underlying TextOutput.
 func (t *TextOutput) SetOnError(f func(error)) *TextOutput {
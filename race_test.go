@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package xlog_test
+
+func init() {
+	raceEnabled = true
+}
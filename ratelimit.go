@@ -0,0 +1,169 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitPolicy defines the behavior of RateLimitOutput when the tokens of a severity are exhausted.
+type RateLimitPolicy int
+
+const (
+	// RateLimitDrop drops the log immediately
+	RateLimitDrop RateLimitPolicy = iota
+
+	// RateLimitBlock blocks until a token is available, and drops the log if it can't get a token in the timeout
+	RateLimitBlock
+)
+
+// RateLimitOutput is an implementation of Output that limits the throughput of logs to the given output by using an
+// independent token bucket for every single severity. The severities without limit aren't limited.
+type RateLimitOutput struct {
+	dropped      [SeverityPanic + 1]uint64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
+	output       Output
+	mu           sync.Mutex
+	buckets      [SeverityPanic + 1]*tokenBucket
+	policy       RateLimitPolicy
+	blockTimeout time.Duration
+	now          func() time.Time
+	sleep        func(d time.Duration)
+}
+
+// NewRateLimitOutput creates a new RateLimitOutput by the given output. By default, there is no limit and the
+// policy is RateLimitDrop.
+func NewRateLimitOutput(output Output) *RateLimitOutput {
+	return &RateLimitOutput{
+		output: output,
+		policy: RateLimitDrop,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// Log is implementation of Output.
+func (r *RateLimitOutput) Log(log *Log) {
+	severity := log.Severity
+	if !severity.IsValid() {
+		r.output.Log(log)
+		return
+	}
+	r.mu.Lock()
+	bucket, policy, blockTimeout, sleep := r.buckets[severity], r.policy, r.blockTimeout, r.sleep
+	var wait time.Duration
+	ok := true
+	if bucket != nil {
+		if policy != RateLimitBlock {
+			blockTimeout = 0
+		}
+		wait, ok = bucket.reserve(r.now(), blockTimeout)
+	}
+	r.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&r.dropped[severity], 1)
+		log.Release()
+		return
+	}
+	if wait > 0 {
+		sleep(wait)
+	}
+	r.output.Log(log)
+}
+
+// Flush is implementation of Flusher.
+func (r *RateLimitOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, r.output)
+}
+
+// Close is implementation of Closer.
+func (r *RateLimitOutput) Close() error {
+	return closeOutput(r.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (r *RateLimitOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(r.output, f)
+}
+
+// SetLimit sets the rate as logs per second and the burst size of the given severity.
+// If rate is 0 or less, the severity isn't limited.
+// It returns underlying RateLimitOutput.
+func (r *RateLimitOutput) SetLimit(severity Severity, rate float64, burst int) *RateLimitOutput {
+	if !severity.IsValid() {
+		return r
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rate <= 0 {
+		r.buckets[severity] = nil
+		return r
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	r.buckets[severity] = &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   r.now(),
+	}
+	return r
+}
+
+// SetPolicy sets the policy of RateLimitOutput when the tokens are exhausted. The argument blockTimeout is the
+// maximum duration to wait for a token with RateLimitBlock.
+// It returns underlying RateLimitOutput.
+func (r *RateLimitOutput) SetPolicy(policy RateLimitPolicy, blockTimeout time.Duration) *RateLimitOutput {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	r.blockTimeout = blockTimeout
+	return r
+}
+
+// Dropped returns the number of the dropped logs of the given severity.
+func (r *RateLimitOutput) Dropped(severity Severity) uint64 {
+	if !severity.IsValid() {
+		return 0
+	}
+	return atomic.LoadUint64(&r.dropped[severity])
+}
+
+// DroppedTotal returns the total number of the dropped logs.
+func (r *RateLimitOutput) DroppedTotal() uint64 {
+	var n uint64
+	for i := range r.dropped {
+		n += atomic.LoadUint64(&r.dropped[i])
+	}
+	return n
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token, and returns the duration to wait for it. If the token can't be available in maxWait, it
+// returns false without taking the token.
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (wait time.Duration, ok bool) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
@@ -0,0 +1,67 @@
+package xlog_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleRateLimitOutput() {
+	limiter := xlog.NewRateLimitOutput(xlog.NewTextOutput(os.Stdout))
+	limiter.SetLimit(xlog.SeverityError, 0.001, 2)
+	logger := xlog.New(limiter, xlog.SeverityInfo, 0)
+	logger.SetFlags(xlog.FlagSeverity)
+
+	for i := 1; i <= 5; i++ {
+		logger.Errorf("this is error log #%d.", i)
+	}
+	logger.Info("this is info log. it isn't limited.")
+	fmt.Println(limiter.Dropped(xlog.SeverityError), limiter.DroppedTotal())
+
+	// Output:
+	// ERROR - this is error log #1.
+	// ERROR - this is error log #2.
+	// INFO - this is info log. it isn't limited.
+	// 3 3
+}
+
+func TestRateLimitOutput_block(t *testing.T) {
+	now := testTime
+	var slept time.Duration
+	limiter := xlog.NewRateLimitOutput(xlog.NewTextOutput(ioutil.Discard))
+	limiter.SetClock(func() time.Time {
+		return now
+	}, func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	})
+	limiter.SetLimit(xlog.SeverityInfo, 100, 1)
+	limiter.SetPolicy(xlog.RateLimitBlock, 50*time.Millisecond)
+	logger := xlog.New(limiter, xlog.SeverityInfo, 0)
+
+	for i := 0; i < 4; i++ {
+		logger.Info("blocking")
+	}
+	if slept < 29*time.Millisecond || slept > 30*time.Millisecond {
+		t.Errorf("slept %v, want 30ms", slept)
+	}
+	if n := limiter.DroppedTotal(); n != 0 {
+		t.Errorf("dropped %d logs, want 0", n)
+	}
+
+	slept = 0
+	limiter.SetPolicy(xlog.RateLimitBlock, 5*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		logger.Info("blocking")
+	}
+	if slept != 0 {
+		t.Errorf("slept %v, want 0", slept)
+	}
+	if n := limiter.Dropped(xlog.SeverityInfo); n != 4 {
+		t.Errorf("dropped %d logs, want 4", n)
+	}
+}
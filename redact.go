@@ -0,0 +1,352 @@
+package xlog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/goinsane/erf"
+)
+
+var (
+	ErrInvalidRedactRule = errors.New("invalid redact rule")
+)
+
+// RedactAction defines what RedactOutput does with a sensitive field or text.
+type RedactAction int
+
+const (
+	// RedactMask replaces the value with "***"
+	RedactMask RedactAction = iota
+
+	// RedactHash replaces the value with "sha256:" and the first 16 hex digits of its SHA-256 hash, or HMAC-SHA256
+	// hash if the hash key is set
+	RedactHash
+
+	// RedactDrop removes the field, or the text from the message and the error text
+	RedactDrop
+)
+
+const (
+	redactMask = "***"
+
+	// redactMaxKeys is the maximum number of the field keys whose matching rules are cached.
+	redactMaxKeys = 4096
+)
+
+// RedactRule is a rule of RedactOutput. A rule has either Key to redact the fields, or Pattern to redact the message
+// and the error text.
+type RedactRule struct {
+	// Key is a case-insensitive glob pattern of the field keys like "*password*", in the syntax of path.Match.
+	Key string
+
+	// Pattern is a regular expression of the sensitive texts in the message and the error text.
+	Pattern *regexp.Regexp
+
+	// Action is the action to redact.
+	Action RedactAction
+}
+
+// RedactOutput is an implementation of Output that redacts the sensitive fields by their keys, and the sensitive
+// texts in the message and the error text by regular expressions, before passing the logs to the given output.
+// The first matching rule of a field is applied. If the error text is redacted, the error of the Log is kept, and
+// the redacted text is available by Log.ErrorText. The texts and the fields of the *erf.Erf errors are redacted in
+// Log.ErfStackTrace as well.
+type RedactOutput struct {
+	redactions  uint64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
+	output      Output
+	fieldRules  []RedactRule
+	textRules   []RedactRule
+	keyRules    sync.Map
+	keyRulesLen int32
+	hashKey     atomic.Value
+}
+
+// NewRedactOutput creates a new RedactOutput by the given output and rules.
+// It returns ErrInvalidRedactRule if a rule is invalid.
+func NewRedactOutput(output Output, rules ...RedactRule) (*RedactOutput, error) {
+	r := &RedactOutput{
+		output: output,
+	}
+	for i, rule := range rules {
+		if (rule.Key == "") == (rule.Pattern == nil) {
+			return nil, fmt.Errorf("%w: rule %d must have either key or pattern", ErrInvalidRedactRule, i)
+		}
+		if rule.Action < RedactMask || rule.Action > RedactDrop {
+			return nil, fmt.Errorf("%w: rule %d has unknown action %d", ErrInvalidRedactRule, i, rule.Action)
+		}
+		if rule.Key != "" {
+			rule.Key = strings.ToLower(rule.Key)
+			if _, err := path.Match(rule.Key, ""); err != nil {
+				return nil, fmt.Errorf("%w: rule %d has invalid key %q", ErrInvalidRedactRule, i, rule.Key)
+			}
+			r.fieldRules = append(r.fieldRules, rule)
+			continue
+		}
+		r.textRules = append(r.textRules, rule)
+	}
+	return r, nil
+}
+
+// Log is implementation of Output.
+func (r *RedactOutput) Log(log *Log) {
+	if !r.matches(log) {
+		r.output.Log(log)
+		return
+	}
+	log2 := log.Duplicate()
+	log.Release()
+	var n uint64
+
+	fields := log2.Fields[:0]
+	for _, field := range log2.Fields {
+		if r.fieldRule(field.Key) == nil {
+			fields = append(fields, field)
+			continue
+		}
+		n++
+		value, ok := r.redactField(field.Key, field.Value)
+		if !ok {
+			continue
+		}
+		field.Value = value
+		fields = append(fields, field)
+	}
+	for i := len(fields); i < len(log2.Fields); i++ {
+		log2.Fields[i] = Field{}
+	}
+	log2.Fields = fields
+
+	if len(r.textRules) > 0 {
+		log2.Message = append(log2.Message[:0], r.redactText(log2.Message, &n)...)
+		if log2.Error != nil {
+			text := log2.ErrorText()
+			if redacted := r.redactText([]byte(text), &n); string(redacted) != text {
+				log2.setErrorText(string(redacted))
+			}
+		}
+	}
+	if _, ok := log2.Error.(*erf.Erf); ok {
+		log2.redactors = append(log2.redactors, r)
+	}
+
+	atomic.AddUint64(&r.redactions, n)
+	r.output.Log(log2)
+}
+
+// redactField returns the value of the field redacted by the first matching rule of the key. It returns false if
+// the field is dropped.
+func (r *RedactOutput) redactField(key string, value interface{}) (interface{}, bool) {
+	rule := r.fieldRule(key)
+	if rule == nil {
+		return value, true
+	}
+	switch rule.Action {
+	case RedactHash:
+		buf := getBuffer()
+		buf.b = appendValue(buf.b, value)
+		value = r.hash(buf.b)
+		putBuffer(buf)
+	case RedactDrop:
+		return nil, false
+	default:
+		value = redactMask
+	}
+	return value, true
+}
+
+// redactText returns the text redacted by the text rules, and adds the number of the redactions to n if n isn't nil.
+// It returns the given text if no rule matches.
+func (r *RedactOutput) redactText(text []byte, n *uint64) []byte {
+	for i := range r.textRules {
+		rule := &r.textRules[i]
+		if !rule.Pattern.Match(text) {
+			continue
+		}
+		text = rule.Pattern.ReplaceAllFunc(text, func(match []byte) []byte {
+			if n != nil {
+				*n++
+			}
+			switch rule.Action {
+			case RedactHash:
+				return []byte(r.hash(match))
+			case RedactDrop:
+				return nil
+			default:
+				return []byte(redactMask)
+			}
+		})
+	}
+	return text
+}
+
+// Redactions returns the total number of the redacted fields and texts.
+func (r *RedactOutput) Redactions() uint64 {
+	return atomic.LoadUint64(&r.redactions)
+}
+
+// SetHashKey sets the key to hash the values by HMAC-SHA256 for RedactHash. The key prevents guessing the values
+// which have small sets of possible values like card numbers.
+// It returns underlying RedactOutput.
+// By default, nil that means plain SHA-256.
+func (r *RedactOutput) SetHashKey(key []byte) *RedactOutput {
+	r.hashKey.Store(append([]byte(nil), key...))
+	return r
+}
+
+// Flush is implementation of Flusher.
+func (r *RedactOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, r.output)
+}
+
+// Close is implementation of Closer.
+func (r *RedactOutput) Close() error {
+	return closeOutput(r.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (r *RedactOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(r.output, f)
+}
+
+// matches returns whether any rule matches the Log.
+func (r *RedactOutput) matches(log *Log) bool {
+	for i := range log.Fields {
+		if r.fieldRule(log.Fields[i].Key) != nil {
+			return true
+		}
+	}
+	for i := range r.textRules {
+		pattern := r.textRules[i].Pattern
+		if pattern.Match(log.Message) || (log.Error != nil && pattern.MatchString(log.ErrorText())) {
+			return true
+		}
+	}
+	if e, ok := log.Error.(*erf.Erf); ok && len(r.fieldRules) > 0 {
+		for _, err := range e.UnwrapAll() {
+			if e2, ok := err.(*erf.Erf); ok {
+				for _, tag := range e2.Tags() {
+					if r.fieldRule(tag) != nil {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fieldRule returns the first field rule which matches the key, or nil. The results are cached by the keys up to
+// redactMaxKeys keys.
+func (r *RedactOutput) fieldRule(key string) *RedactRule {
+	if len(r.fieldRules) == 0 {
+		return nil
+	}
+	if idx, ok := r.keyRules.Load(key); ok {
+		if idx.(int) < 0 {
+			return nil
+		}
+		return &r.fieldRules[idx.(int)]
+	}
+	lowerKey, idx := strings.ToLower(key), -1
+	for i := range r.fieldRules {
+		if ok, _ := path.Match(r.fieldRules[i].Key, lowerKey); ok {
+			idx = i
+			break
+		}
+	}
+	if atomic.LoadInt32(&r.keyRulesLen) < redactMaxKeys {
+		if _, loaded := r.keyRules.LoadOrStore(key, idx); !loaded {
+			atomic.AddInt32(&r.keyRulesLen, 1)
+		}
+	}
+	if idx < 0 {
+		return nil
+	}
+	return &r.fieldRules[idx]
+}
+
+// hash returns the hash of the value for RedactHash.
+func (r *RedactOutput) hash(value []byte) string {
+	var h hash.Hash
+	if key, _ := r.hashKey.Load().([]byte); len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	_, _ = h.Write(value)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// redactedErfStackTrace returns the stack trace of the *erf.Erf error like Log.ErfStackTrace, and redacts the error
+// texts and the error fields by the RedactOutputs in order.
+func redactedErfStackTrace(e *erf.Erf, flags Flag, redactors []*RedactOutput) string {
+	var b []byte
+	for idx, err := range e.UnwrapAll() {
+		if idx > 0 {
+			b = append(b, '\n')
+		}
+		if flags&FlagErfMessage != 0 {
+			text := []byte(err.Error())
+			for _, r := range redactors {
+				text = r.redactText(text, nil)
+			}
+			for _, line := range strings.Split(string(text), "\n") {
+				b = append(b, "\t\t"...)
+				b = append(b, line...)
+				b = append(b, '\n')
+			}
+		}
+		e2, ok := err.(*erf.Erf)
+		if !ok {
+			if flags&FlagErfMessage == 0 {
+				b = append(b, "\t- \n"...)
+			}
+			b = append(b, '\t')
+			continue
+		}
+		if str := fmt.Sprintf("%+1.1s", e2.StackTrace()); str != "" {
+			b = append(b, str...)
+		} else {
+			b = append(b, "\t* "...)
+		}
+		b = append(b, '\n')
+		if flags&FlagErfFields != 0 {
+			start := len(b)
+			b = append(b, "\t+ "...)
+			n := 0
+			for _, tag := range e2.Tags() {
+				value, ok := interface{}(fmt.Sprintf("%v", e2.Tag(tag))), true
+				for _, r := range redactors {
+					if value, ok = r.redactField(tag, value); !ok {
+						break
+					}
+				}
+				if !ok {
+					continue
+				}
+				if n > 0 {
+					b = append(b, ' ')
+				}
+				n++
+				b = append(b, fmt.Sprintf("%q=%q", tag, fmt.Sprintf("%v", value))...)
+			}
+			if n > 0 {
+				b = append(b, '\n')
+			} else {
+				b = b[:start]
+			}
+		}
+		b = append(b, '\t')
+	}
+	return string(b)
+}
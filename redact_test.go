@@ -0,0 +1,115 @@
+package xlog_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/goinsane/erf"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleNewRedactOutput() {
+	output, err := xlog.NewRedactOutput(xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity),
+		xlog.RedactRule{Key: "*password*", Action: xlog.RedactMask},
+		xlog.RedactRule{Key: "Token", Action: xlog.RedactHash},
+		xlog.RedactRule{Key: "card", Action: xlog.RedactDrop},
+		xlog.RedactRule{Pattern: regexp.MustCompile(`\b\d{4}(?:[ -]?\d{4}){3}\b`), Action: xlog.RedactMask},
+	)
+	if err != nil {
+		panic(err)
+	}
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+
+	logger.WithFieldKeyVals("user", "alice", "db_password", "secret", "TOKEN", "abc", "card", "4111").
+		Info("payment by 4111 1111 1111 1111 accepted.")
+	logger.Info("nothing to redact.")
+
+	// Output:
+	// INFO - payment by *** accepted.
+	// INFO - nothing to redact.
+}
+
+func TestRedactOutput(t *testing.T) {
+	var logs []*xlog.Log
+	output, err := xlog.NewRedactOutput(&recordLogsOutput{logs: &logs},
+		xlog.RedactRule{Key: "*password*", Action: xlog.RedactMask},
+		xlog.RedactRule{Key: "Token", Action: xlog.RedactHash},
+		xlog.RedactRule{Key: "card", Action: xlog.RedactDrop},
+		xlog.RedactRule{Pattern: regexp.MustCompile(`secret=\S+`), Action: xlog.RedactDrop},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger.WithFieldKeyVals("user", "alice", "db_password", "secret", "TOKEN", "abc", "card", "4111").
+		Errorf("login failed: %w", errors.New("bad secret=1234"))
+
+	if len(logs) != 1 {
+		t.Fatalf("%d logs, want 1", len(logs))
+	}
+	log := logs[0]
+	if got, want := string(log.Message), "login failed: bad "; got != want {
+		t.Errorf("message %q, want %q", got, want)
+	}
+	if got, want := log.ErrorText(), "bad "; got != want {
+		t.Errorf("error %q, want %q", got, want)
+	}
+	want := xlog.Fields{
+		{Key: "user", Value: "alice"},
+		{Key: "db_password", Value: "***"},
+		{Key: "TOKEN", Value: "sha256:ba7816bf8f01cfea"},
+	}
+	if len(log.Fields) != len(want) {
+		t.Fatalf("fields %v, want %v", log.Fields, want)
+	}
+	for i := range want {
+		if log.Fields[i].Key != want[i].Key || log.Fields[i].Value != want[i].Value {
+			t.Errorf("field %d %v, want %v", i, log.Fields[i], want[i])
+		}
+	}
+	if n := output.Redactions(); n != 5 {
+		t.Errorf("redactions %d, want 5", n)
+	}
+
+	if _, err := xlog.NewRedactOutput(nil, xlog.RedactRule{Key: "[", Action: xlog.RedactMask}); !errors.Is(err, xlog.ErrInvalidRedactRule) {
+		t.Errorf("error %v, want %v", err, xlog.ErrInvalidRedactRule)
+	}
+}
+
+func TestRedactOutput_erf(t *testing.T) {
+	var buf bytes.Buffer
+	output, err := xlog.NewRedactOutput(xlog.NewTextOutput(&buf).
+		SetFlags(xlog.FlagErfStackTrace|xlog.FlagErfMessage|xlog.FlagErfFields),
+		xlog.RedactRule{Key: "*password*", Action: xlog.RedactMask},
+		xlog.RedactRule{Pattern: regexp.MustCompile(`secret=\S+`), Action: xlog.RedactDrop},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger.Error("login failed: ", erf.Newf("bad secret=%s", "1234").Attach("password"))
+
+	got := buf.String()
+	for _, want := range []string{"\t\tbad \n", "redact_test.go:", `+ "password"="***"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output %q doesn't contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "1234") {
+		t.Errorf("output %q isn't redacted", got)
+	}
+}
+
+// recordLogsOutput keeps the logs.
+type recordLogsOutput struct {
+	logs *[]*xlog.Log
+}
+
+func (o *recordLogsOutput) Log(log *xlog.Log) {
+	*o.logs = append(*o.logs, log)
+}
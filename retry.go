@@ -0,0 +1,271 @@
+package xlog
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var (
+	ErrOutputClosed = errors.New("output closed")
+)
+
+// RetryOptions defines the retry policy of RetryOutput.
+type RetryOptions struct {
+	// MinBackoff is the backoff before the first retry. By default, 100ms.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff between retries. By default, 10s.
+	MaxBackoff time.Duration
+
+	// Multiplier multiplies the backoff after every retry. By default, 2.
+	Multiplier float64
+
+	// Jitter randomizes every backoff in the range of [backoff*(1-Jitter), backoff*(1+Jitter)]. By default, 0.
+	Jitter float64
+
+	// MaxAttempts is the maximum number of attempts for a Log including the first one. By default, 0 that means
+	// unlimited.
+	MaxAttempts int
+
+	// MaxAge is the maximum duration to retry a Log since the first attempt. By default, 0 that means unlimited.
+	MaxAge time.Duration
+}
+
+// RetryOutput is an implementation of ErrorOutput that retries writing the logs to the given output with exponential
+// backoff and jitter. RetryOutput retries in the goroutine of the caller, it may be wrapped by QueuedOutput to unblock
+// the caller.
+type RetryOutput struct {
+	output    ErrorOutput
+	opts      RetryOptions
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	onError   *func(error)
+}
+
+// NewRetryOutput creates a new RetryOutput by the given output.
+func NewRetryOutput(output ErrorOutput, opts RetryOptions) (r *RetryOutput) {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Second
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 2
+	}
+	if opts.Jitter < 0 {
+		opts.Jitter = 0
+	}
+	if opts.Jitter > 1 {
+		opts.Jitter = 1
+	}
+	r = &RetryOutput{
+		output: output,
+		opts:   opts,
+	}
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	return
+}
+
+// Close closes RetryOutput and the underlying output. It cancels the ongoing retries.
+func (r *RetryOutput) Close() error {
+	r.ctxCancel()
+	return closeOutput(r.output)
+}
+
+// Flush is implementation of Flusher.
+func (r *RetryOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, r.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (r *RetryOutput) SetErrorReporter(f func(error)) {
+	r.SetOnError(f)
+	setErrorReporter(r.output, f)
+}
+
+// Log is implementation of Output.
+// If all the attempts fail, it calls OnError function with the last error.
+func (r *RetryOutput) Log(log *Log) {
+	err := r.TryLog(log)
+	log.Release()
+	if err != nil {
+		reportError(&r.onError, err)
+	}
+}
+
+// TryLog is implementation of ErrorOutput.
+// It returns the last error if all the attempts fail.
+func (r *RetryOutput) TryLog(log *Log) error {
+	start := time.Now()
+	backoff := r.opts.MinBackoff
+	for attempt := 1; ; attempt++ {
+		if r.ctx.Err() != nil {
+			return ErrOutputClosed
+		}
+		err := r.output.TryLog(log)
+		if err == nil {
+			return nil
+		}
+		if r.opts.MaxAttempts > 0 && attempt >= r.opts.MaxAttempts {
+			return err
+		}
+		wait := backoff
+		if r.opts.Jitter > 0 {
+			wait = time.Duration(float64(wait) * (1 + r.opts.Jitter*(2*rand.Float64()-1)))
+		}
+		if r.opts.MaxAge > 0 && time.Since(start)+wait > r.opts.MaxAge {
+			return err
+		}
+		select {
+		case <-r.ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = time.Duration(float64(backoff) * r.opts.Multiplier)
+		if backoff > r.opts.MaxBackoff {
+			backoff = r.opts.MaxBackoff
+		}
+	}
+}
+
+// SetOnError sets a function to call when all the attempts fail.
+// It returns underlying RetryOutput.
+func (r *RetryOutput) SetOnError(f func(error)) *RetryOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&r.onError)), unsafe.Pointer(&f))
+	return r
+}
+
+// FailoverOutput is an implementation of ErrorOutput that writes the logs to the primary output, and falls back to the
+// secondary output when the primary keeps failing. The logs which the primary fails to write are written to the
+// secondary. After the given number of consecutive failures, FailoverOutput writes the logs to the secondary directly
+// during the cooldown, and then tries the primary again.
+type FailoverOutput struct {
+	mu        sync.Mutex
+	primary   ErrorOutput
+	secondary Output
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	failedAt  time.Time
+	onError   *func(error)
+}
+
+// NewFailoverOutput creates a new FailoverOutput by the given primary and secondary outputs.
+// By default, the threshold is 3 consecutive failures and the cooldown is 30s.
+func NewFailoverOutput(primary ErrorOutput, secondary Output) *FailoverOutput {
+	return &FailoverOutput{
+		primary:   primary,
+		secondary: secondary,
+		threshold: 3,
+		cooldown:  30 * time.Second,
+	}
+}
+
+// Log is implementation of Output.
+func (f *FailoverOutput) Log(log *Log) {
+	if f.tryPrimary(log) {
+		log.Release()
+		return
+	}
+	f.secondary.Log(log)
+}
+
+// TryLog is implementation of ErrorOutput.
+// It returns the error of the secondary output if the secondary is an ErrorOutput.
+func (f *FailoverOutput) TryLog(log *Log) error {
+	if f.tryPrimary(log) {
+		return nil
+	}
+	if secondary, ok := f.secondary.(ErrorOutput); ok {
+		return secondary.TryLog(log)
+	}
+	log.retain(1)
+	f.secondary.Log(log)
+	return nil
+}
+
+// tryPrimary writes the Log to the primary output unless FailoverOutput has failed over, and returns whether it
+// succeeds.
+func (f *FailoverOutput) tryPrimary(log *Log) bool {
+	if f.IsFailedOver() {
+		return false
+	}
+	err := f.primary.TryLog(log)
+	f.mu.Lock()
+	if err == nil {
+		f.failures = 0
+		f.mu.Unlock()
+		return true
+	}
+	f.failures++
+	if f.failures >= f.threshold {
+		f.failedAt = time.Now()
+	}
+	f.mu.Unlock()
+	reportError(&f.onError, err)
+	return false
+}
+
+// IsFailedOver returns whether FailoverOutput writes the logs to the secondary output directly.
+func (f *FailoverOutput) IsFailedOver() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failures >= f.threshold && time.Since(f.failedAt) < f.cooldown
+}
+
+// SetThreshold sets the number of consecutive failures of the primary output to fall back, and the cooldown to try
+// the primary again.
+// It returns underlying FailoverOutput.
+func (f *FailoverOutput) SetThreshold(threshold int, cooldown time.Duration) *FailoverOutput {
+	if threshold < 1 {
+		threshold = 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.threshold = threshold
+	f.cooldown = cooldown
+	return f
+}
+
+// Flush is implementation of Flusher.
+// It flushes both of the outputs, and returns the first error.
+func (f *FailoverOutput) Flush(ctx context.Context) error {
+	err := flushOutput(ctx, f.primary)
+	if e := flushOutput(ctx, f.secondary); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Close is implementation of Closer.
+// It closes both of the outputs, and returns the first error.
+func (f *FailoverOutput) Close() error {
+	err := closeOutput(f.primary)
+	if e := closeOutput(f.secondary); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (f *FailoverOutput) SetErrorReporter(onError func(error)) {
+	f.SetOnError(onError)
+	setErrorReporter(f.primary, onError)
+	setErrorReporter(f.secondary, onError)
+}
+
+// SetOnError sets a function to call when the primary output fails.
+// It returns underlying FailoverOutput.
+func (f *FailoverOutput) SetOnError(onError func(error)) *FailoverOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&f.onError)), unsafe.Pointer(&onError))
+	return f
+}
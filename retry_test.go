@@ -0,0 +1,81 @@
+package xlog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+// flakyOutput fails the first attempts, and then writes the logs to output.
+type flakyOutput struct {
+	output   *xlog.TextOutput
+	failures int32
+	attempts int32
+}
+
+func (f *flakyOutput) Log(log *xlog.Log) {
+	_ = f.TryLog(log)
+	log.Release()
+}
+
+func (f *flakyOutput) TryLog(log *xlog.Log) error {
+	if atomic.AddInt32(&f.attempts, 1) <= atomic.LoadInt32(&f.failures) {
+		return errors.New("flaky output failed")
+	}
+	return f.output.TryLog(log)
+}
+
+func TestRetryOutput(t *testing.T) {
+	flaky := &flakyOutput{output: xlog.NewTextOutput(ioutil.Discard), failures: 2}
+	var lastErr error
+	retry := xlog.NewRetryOutput(flaky, xlog.RetryOptions{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		Jitter:      0.5,
+		MaxAttempts: 3,
+	}).SetOnError(func(err error) {
+		lastErr = err
+	})
+	defer retry.Close()
+	logger := xlog.New(retry, xlog.SeverityInfo, 0)
+
+	logger.Info("retry succeeds.")
+	if n := atomic.LoadInt32(&flaky.attempts); n != 3 {
+		t.Errorf("attempts %d, want 3", n)
+	}
+	if lastErr != nil {
+		t.Errorf("error %v, want nil", lastErr)
+	}
+
+	atomic.StoreInt32(&flaky.attempts, 0)
+	atomic.StoreInt32(&flaky.failures, 5)
+	logger.Info("retry fails.")
+	if n := atomic.LoadInt32(&flaky.attempts); n != 3 {
+		t.Errorf("attempts %d, want 3", n)
+	}
+	if lastErr == nil {
+		t.Errorf("error nil, want error")
+	}
+}
+
+func ExampleFailoverOutput() {
+	primary := &flakyOutput{output: xlog.NewTextOutput(os.Stdout), failures: 2}
+	secondary := xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity)
+	failover := xlog.NewFailoverOutput(primary, secondary).SetThreshold(2, time.Hour)
+	logger := xlog.New(failover, xlog.SeverityInfo, 0)
+	logger.SetFlags(0)
+
+	logger.Info("this is info log #1. it will be written by the secondary.")
+	logger.Info("this is info log #2. it will be written by the secondary.")
+	logger.Info("this is info log #3. it will be written by the secondary during the cooldown.")
+
+	// Output:
+	// INFO - this is info log #1. it will be written by the secondary.
+	// INFO - this is info log #2. it will be written by the secondary.
+	// INFO - this is info log #3. it will be written by the secondary during the cooldown.
+}
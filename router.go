@@ -0,0 +1,235 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// KeyFunc returns the routing key of the given Log. A KeyFunc must not modify or keep the Log.
+type KeyFunc func(log *Log) string
+
+// KeyByField returns a KeyFunc that returns the value of the last field which has the given key.
+// If there is no field which has the key, the KeyFunc returns empty string.
+func KeyByField(key string) KeyFunc {
+	return func(log *Log) string {
+		field, ok := lookupField(log.Fields, key)
+		if !ok {
+			return ""
+		}
+		if s, ok := field.Value.(string); ok {
+			return s
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		buf.b = appendValue(buf.b, field.Value)
+		return string(buf.b)
+	}
+}
+
+// KeyBySeverity returns a KeyFunc that returns the text of the severity of the Log, e.g. ERROR.
+func KeyBySeverity() KeyFunc {
+	return func(log *Log) string {
+		return log.Severity.String()
+	}
+}
+
+// RouterOutput is an implementation of Output that dispatches every single Log to exactly one of the Outputs by the
+// key of the Log. RouterOutput creates the Output of a key lazily by calling the factory function, and evicts the
+// Outputs which are idle during the idle timeout. The Outputs implementing Closer are closed when they are evicted.
+type RouterOutput struct {
+	idleTimeout int64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
+	mu          sync.Mutex
+	keyFunc     KeyFunc
+	factory     func(key string) (Output, error)
+	routes      map[string]*routerRoute
+	ctx         context.Context
+	ctxCancel   context.CancelFunc
+	onError     *func(error)
+}
+
+type routerRoute struct {
+	mu       sync.RWMutex
+	output   Output
+	lastUsed time.Time
+}
+
+// NewRouterOutput creates a new RouterOutput by the given keyFunc and factory.
+// The factory is called under the lock of RouterOutput, once for every key which hasn't an Output.
+// If the factory returns nil Output, the logs of the key are dropped.
+func NewRouterOutput(keyFunc KeyFunc, factory func(key string) (Output, error)) (r *RouterOutput) {
+	r = &RouterOutput{
+		keyFunc: keyFunc,
+		factory: factory,
+		routes:  make(map[string]*routerRoute),
+	}
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	go r.evictor()
+	return
+}
+
+// Close closes RouterOutput and all the Outputs created by it. Unused RouterOutput must be closed for freeing
+// resources. It returns the first error of closing the Outputs.
+func (r *RouterOutput) Close() error {
+	r.ctxCancel()
+	r.mu.Lock()
+	routes := r.routes
+	r.routes = make(map[string]*routerRoute)
+	r.mu.Unlock()
+	var err error
+	for _, route := range routes {
+		if e := route.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Log is implementation of Output.
+func (r *RouterOutput) Log(log *Log) {
+	select {
+	case <-r.ctx.Done():
+		log.Release()
+		return
+	default:
+	}
+	key := r.keyFunc(log)
+
+	r.mu.Lock()
+	route := r.routes[key]
+	if route == nil {
+		output, err := r.factory(key)
+		if err != nil {
+			r.mu.Unlock()
+			log.Release()
+			reportError(&r.onError, err)
+			return
+		}
+		route = &routerRoute{
+			output: output,
+		}
+		r.routes[key] = route
+	}
+	route.lastUsed = time.Now()
+	route.mu.RLock()
+	r.mu.Unlock()
+	defer route.mu.RUnlock()
+
+	if route.output == nil {
+		log.Release()
+		return
+	}
+	route.output.Log(log)
+}
+
+// Flush is implementation of Flusher.
+// It flushes all the Outputs created by RouterOutput, and returns the first error.
+func (r *RouterOutput) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	routes := make([]*routerRoute, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, route)
+	}
+	r.mu.Unlock()
+	var err error
+	for _, route := range routes {
+		route.mu.RLock()
+		e := flushOutput(ctx, route.output)
+		route.mu.RUnlock()
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+// The Outputs created by RouterOutput should set their own error reporters in the factory.
+func (r *RouterOutput) SetErrorReporter(f func(error)) {
+	r.SetOnError(f)
+}
+
+// Keys returns the keys which have an Output.
+func (r *RouterOutput) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.routes))
+	for key := range r.routes {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Evict evicts the Output of the given key, and closes it if it implements Closer.
+func (r *RouterOutput) Evict(key string) error {
+	r.mu.Lock()
+	route := r.routes[key]
+	delete(r.routes, key)
+	r.mu.Unlock()
+	if route == nil {
+		return nil
+	}
+	return route.close()
+}
+
+// EvictIdle evicts the Outputs which haven't been used since the idle timeout.
+// It does nothing if the idle timeout is 0.
+func (r *RouterOutput) EvictIdle() {
+	idleTimeout := time.Duration(atomic.LoadInt64(&r.idleTimeout))
+	if idleTimeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-idleTimeout)
+	var routes []*routerRoute
+	r.mu.Lock()
+	for key, route := range r.routes {
+		if route.lastUsed.Before(deadline) {
+			delete(r.routes, key)
+			routes = append(routes, route)
+		}
+	}
+	r.mu.Unlock()
+	for _, route := range routes {
+		if err := route.close(); err != nil {
+			reportError(&r.onError, err)
+		}
+	}
+}
+
+// SetIdleTimeout sets the duration to evict the Outputs which aren't used.
+// It returns underlying RouterOutput.
+// By default, 0 that means never.
+func (r *RouterOutput) SetIdleTimeout(idleTimeout time.Duration) *RouterOutput {
+	atomic.StoreInt64(&r.idleTimeout, int64(idleTimeout))
+	return r
+}
+
+// SetOnError sets a function to call when the factory or closing an evicted Output fails.
+// It returns underlying RouterOutput.
+func (r *RouterOutput) SetOnError(f func(error)) *RouterOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&r.onError)), unsafe.Pointer(&f))
+	return r
+}
+
+func (r *RouterOutput) evictor() {
+	for {
+		interval := time.Duration(atomic.LoadInt64(&r.idleTimeout)) / 2
+		if interval <= 0 || interval > time.Second {
+			interval = time.Second
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(interval):
+			r.EvictIdle()
+		}
+	}
+}
+
+func (r *routerRoute) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return closeOutput(r.output)
+}
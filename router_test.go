@@ -0,0 +1,73 @@
+package xlog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+type closerOutput struct {
+	xlog.Output
+	closed *int32
+}
+
+func (c *closerOutput) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return nil
+}
+
+func ExampleRouterOutput() {
+	router := xlog.NewRouterOutput(xlog.KeyByField("tenant"), func(key string) (xlog.Output, error) {
+		return xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity), nil
+	})
+	defer router.Close()
+	logger := xlog.New(router, xlog.SeverityInfo, 0)
+
+	logger.WithFieldKeyVals("tenant", "acme").Info("this is info log of acme.")
+	logger.WithFieldKeyVals("tenant", "globex").Warning("this is warning log of globex.")
+
+	keys := router.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		os.Stdout.WriteString(key + "\n")
+	}
+
+	// Output:
+	// INFO - this is info log of acme.
+	// WARNING - this is warning log of globex.
+	// acme
+	// globex
+}
+
+func TestRouterOutput_EvictIdle(t *testing.T) {
+	var created, closed int32
+	router := xlog.NewRouterOutput(xlog.KeyBySeverity(), func(key string) (xlog.Output, error) {
+		atomic.AddInt32(&created, 1)
+		return &closerOutput{Output: xlog.NewTextOutput(ioutil.Discard), closed: &closed}, nil
+	})
+	defer router.Close()
+	router.SetIdleTimeout(50 * time.Millisecond)
+	logger := xlog.New(router, xlog.SeverityInfo, 0)
+
+	logger.Info("first")
+	logger.Info("second")
+	if n := atomic.LoadInt32(&created); n != 1 {
+		t.Fatalf("created %d outputs, want 1", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&closed); n != 1 {
+		t.Fatalf("closed %d outputs, want 1", n)
+	}
+	if keys := router.Keys(); len(keys) != 0 {
+		t.Fatalf("keys %v, want none", keys)
+	}
+	logger.Info("third")
+	if n := atomic.LoadInt32(&created); n != 2 {
+		t.Fatalf("created %d outputs, want 2", n)
+	}
+}
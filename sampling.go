@@ -0,0 +1,215 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SamplingOutput is an implementation of Output that samples the logs by their message templates and locations.
+// In every interval, it passes the first logs of every single message template, StackCaller location and severity,
+// and then every thereafter-th log of them. The message template is the format of the formatting log methods like
+// Logger.Errorf, otherwise the message itself.
+//
+// SamplingOutput reports the number of suppressed logs at the end of every interval as a WARNING Log which has the
+// field "suppressed".
+//
+// SamplingOutput counts at most 4096 distinct keys in an interval. The logs of the other keys pass without sampling
+// until the next interval.
+type SamplingOutput struct {
+	mu         sync.Mutex
+	output     Output
+	interval   time.Duration
+	first      int
+	thereafter int
+	counters   map[uint64][]samplingCounter
+	keys       int
+	suppressed uint64
+	flags      Flag
+	total      uint64
+	ctx        context.Context
+	ctxCancel  context.CancelFunc
+}
+
+// NewSamplingOutput creates a new SamplingOutput by the given output.
+// If thereafter is 0 or less, the logs after the first logs are suppressed until the next interval.
+func NewSamplingOutput(output Output, interval time.Duration, first, thereafter int) (s *SamplingOutput) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s = &SamplingOutput{
+		output:     output,
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		counters:   make(map[uint64][]samplingCounter),
+	}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	go s.worker()
+	return
+}
+
+// Close closes SamplingOutput and the underlying output after reporting the suppressed logs. Unused SamplingOutput
+// must be closed for freeing resources.
+func (s *SamplingOutput) Close() error {
+	s.ctxCancel()
+	s.report()
+	return closeOutput(s.output)
+}
+
+// Flush is implementation of Flusher.
+func (s *SamplingOutput) Flush(ctx context.Context) error {
+	return flushOutput(ctx, s.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (s *SamplingOutput) SetErrorReporter(f func(error)) {
+	setErrorReporter(s.output, f)
+}
+
+// Log is implementation of Output.
+func (s *SamplingOutput) Log(log *Log) {
+	if s.ctx.Err() != nil {
+		log.Release()
+		return
+	}
+	s.mu.Lock()
+	n := s.count(log)
+	pass := n == 0 || n <= s.first || (s.thereafter > 0 && (n-s.first)%s.thereafter == 0)
+	if !pass {
+		s.suppressed++
+		s.total++
+		s.flags = log.Flags
+	}
+	s.mu.Unlock()
+	if !pass {
+		log.Release()
+		return
+	}
+	s.output.Log(log)
+}
+
+// Suppressed returns the total number of the suppressed logs.
+func (s *SamplingOutput) Suppressed() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+func (s *SamplingOutput) worker() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.report()
+		}
+	}
+}
+
+// report resets the counters and emits the suppressed log count if there is.
+func (s *SamplingOutput) report() {
+	s.mu.Lock()
+	suppressed, flags := s.suppressed, s.flags
+	s.suppressed = 0
+	if s.keys > 0 {
+		s.counters = make(map[uint64][]samplingCounter)
+		s.keys = 0
+	}
+	s.mu.Unlock()
+	if suppressed == 0 {
+		return
+	}
+	log := newLog()
+	log.Message = append(log.Message, "suppressed logs by sampling"...)
+	log.Severity = SeverityWarning
+	log.Time = time.Now()
+	log.Fields = append(log.Fields, Field{Key: "suppressed", Value: suppressed})
+	log.Flags = flags
+	s.output.Log(log)
+}
+
+// samplingMaxKeys is the maximum number of the distinct keys counted by SamplingOutput in an interval.
+const samplingMaxKeys = 4096
+
+// samplingCounter counts the logs of a single key. The hash of the key may collide, so the key is kept to compare.
+type samplingCounter struct {
+	text     string
+	file     string
+	line     int
+	severity Severity
+	n        int
+}
+
+// matches reports whether the Log has the key of the counter.
+func (c *samplingCounter) matches(log *Log) bool {
+	if c.line != log.StackCaller.Line || c.severity != log.Severity || c.file != log.StackCaller.File {
+		return false
+	}
+	if log.template != "" {
+		return c.text == log.template
+	}
+	return c.text == string(log.Message)
+}
+
+// count increases the counter of the key of the Log, and returns the count. If there are samplingMaxKeys keys
+// already, it returns 0 for a new key without counting it.
+func (s *SamplingOutput) count(log *Log) int {
+	key := samplingKey(log)
+	bucket := s.counters[key]
+	for i := range bucket {
+		if bucket[i].matches(log) {
+			bucket[i].n++
+			return bucket[i].n
+		}
+	}
+	if s.keys >= samplingMaxKeys {
+		return 0
+	}
+	text := log.template
+	if text == "" {
+		text = string(log.Message)
+	}
+	s.counters[key] = append(bucket, samplingCounter{
+		text:     text,
+		file:     log.StackCaller.File,
+		line:     log.StackCaller.Line,
+		severity: log.Severity,
+		n:        1,
+	})
+	s.keys++
+	return 1
+}
+
+// samplingKey returns the FNV-1a hash of the message template, the StackCaller location and the severity of the Log.
+func samplingKey(log *Log) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	if log.template != "" {
+		for i := 0; i < len(log.template); i++ {
+			h ^= uint64(log.template[i])
+			h *= prime64
+		}
+	} else {
+		for _, c := range log.Message {
+			h ^= uint64(c)
+			h *= prime64
+		}
+	}
+	h ^= 0xff
+	h *= prime64
+	for i := 0; i < len(log.StackCaller.File); i++ {
+		h ^= uint64(log.StackCaller.File[i])
+		h *= prime64
+	}
+	for _, n := range []uint64{uint64(log.StackCaller.Line), uint64(log.Severity)} {
+		h ^= n
+		h *= prime64
+	}
+	return h
+}
@@ -0,0 +1,135 @@
+package xlog_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+// recordOutput records the messages of the logs, and fails if failing is set.
+type recordOutput struct {
+	mu       sync.Mutex
+	messages []string
+	failing  bool
+}
+
+func (r *recordOutput) Log(log *xlog.Log) {
+	_ = r.TryLog(log)
+	log.Release()
+}
+
+func (r *recordOutput) TryLog(log *xlog.Log) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failing {
+		return errors.New("record output failed")
+	}
+	r.messages = append(r.messages, string(log.Message))
+	return nil
+}
+
+func (r *recordOutput) Messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.messages...)
+}
+
+func ExampleSamplingOutput() {
+	sampler := xlog.NewSamplingOutput(xlog.NewTextOutput(os.Stdout), time.Hour, 2, 3)
+	logger := xlog.New(sampler, xlog.SeverityInfo, 0)
+	logger.SetFlags(xlog.FlagSeverity)
+
+	for i := 1; i <= 10; i++ {
+		logger.Errorf("this is error log #%d.", i)
+	}
+	logger.Info("this is info log.")
+	_ = sampler.Close()
+	fmt.Println(sampler.Suppressed())
+
+	// Output:
+	// ERROR - this is error log #1.
+	// ERROR - this is error log #2.
+	// ERROR - this is error log #5.
+	// ERROR - this is error log #8.
+	// INFO - this is info log.
+	// WARNING - suppressed logs by sampling
+	// 6
+}
+
+func TestSamplingOutput_thereafter(t *testing.T) {
+	output := &recordOutput{}
+	sampler := xlog.NewSamplingOutput(output, time.Hour, 1, 4)
+	logger := xlog.New(sampler, xlog.SeverityInfo, 0)
+
+	for i := 1; i <= 10; i++ {
+		logger.Infof("log #%d", i)
+		logger.Info("same message")
+	}
+	for i := 1; i <= 3; i++ {
+		logger.Info("different message ", i)
+	}
+	_ = sampler.Close()
+
+	want := []string{
+		"log #1", "same message",
+		"log #5", "same message",
+		"log #9", "same message",
+		"different message 1", "different message 2", "different message 3",
+		"suppressed logs by sampling",
+	}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := sampler.Suppressed(); got != 14 {
+		t.Errorf("suppressed = %d, want 14", got)
+	}
+}
+
+func TestSamplingOutput_interval(t *testing.T) {
+	output := &recordOutput{}
+	sampler := xlog.NewSamplingOutput(output, 100*time.Millisecond, 1, 0)
+	defer sampler.Close()
+	logger := xlog.New(sampler, xlog.SeverityInfo, 0)
+
+	waitSummary := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			count := 0
+			for _, msg := range output.Messages() {
+				if msg == "suppressed logs by sampling" {
+					count++
+				}
+			}
+			if count >= n {
+				return
+			}
+		}
+		t.Fatalf("timeout waiting summary #%d", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		logger.Info("sampled")
+	}
+	waitSummary(1)
+	for i := 0; i < 3; i++ {
+		logger.Info("sampled")
+	}
+	waitSummary(2)
+
+	want := []string{
+		"sampled", "suppressed logs by sampling",
+		"sampled", "suppressed logs by sampling",
+	}
+	if got := output.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := sampler.Suppressed(); got != 4 {
+		t.Errorf("suppressed = %d, want 4", got)
+	}
+}
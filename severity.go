@@ -11,6 +11,11 @@ var (
 )
 
 // Severity describes severity level of Log.
+//
+// The severities are ordered from SeverityFatal, the most severe, through SeverityPanic, SeverityError,
+// SeverityWarning and SeverityInfo to SeverityDebug, and Logger logs the severities which are at least as severe as
+// its severity. SeverityPanic has its own value after SeverityDebug, but it is ordered between SeverityFatal and
+// SeverityError.
 type Severity int
 
 const (
@@ -31,12 +36,32 @@ const (
 
 	// SeverityDebug is debug severity level
 	SeverityDebug
+
+	// SeverityPanic is panic severity level
+	SeverityPanic
 )
 
 // String is implementation of fmt.Stringer.
+// If s is invalid, it returns empty string.
 func (s Severity) String() string {
-	text, _ := s.MarshalText()
-	return string(text)
+	switch s {
+	case SeverityNone:
+		return "NONE"
+	case SeverityFatal:
+		return "FATAL"
+	case SeverityPanic:
+		return "PANIC"
+	case SeverityError:
+		return "ERROR"
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityInfo:
+		return "INFO"
+	case SeverityDebug:
+		return "DEBUG"
+	default:
+		return ""
+	}
 }
 
 // IsValid returns whether s is valid.
@@ -46,36 +71,41 @@ func (s Severity) IsValid() bool {
 
 // CheckValid returns ErrInvalidSeverity for invalid s.
 func (s Severity) CheckValid() error {
-	if !(SeverityNone <= s && s <= SeverityDebug) {
+	if !(SeverityNone <= s && s <= SeverityPanic) {
 		return ErrInvalidSeverity
 	}
 	return nil
 }
 
-// MarshalText is implementation of encoding.TextMarshaler.
-// If s is invalid, it returns nil and result of Severity.CheckValid.
-func (s Severity) MarshalText() (text []byte, err error) {
-	if e := s.CheckValid(); e != nil {
-		return nil, e
-	}
-	var str string
+// rank returns the order of s to compare the severities. The more severe severity has the less rank.
+func (s Severity) rank() int {
 	switch s {
 	case SeverityNone:
-		str = "NONE"
+		return 0
 	case SeverityFatal:
-		str = "FATAL"
+		return 1
+	case SeverityPanic:
+		return 2
 	case SeverityError:
-		str = "ERROR"
+		return 3
 	case SeverityWarning:
-		str = "WARNING"
+		return 4
 	case SeverityInfo:
-		str = "INFO"
+		return 5
 	case SeverityDebug:
-		str = "DEBUG"
+		return 6
 	default:
-		panic("invalid severity")
+		return int(s) + 1
+	}
+}
+
+// MarshalText is implementation of encoding.TextMarshaler.
+// If s is invalid, it returns nil and result of Severity.CheckValid.
+func (s Severity) MarshalText() (text []byte, err error) {
+	if e := s.CheckValid(); e != nil {
+		return nil, e
 	}
-	return []byte(str), nil
+	return []byte(s.String()), nil
 }
 
 // UnmarshalText is implementation of encoding.UnmarshalText.
@@ -86,6 +116,8 @@ func (s *Severity) UnmarshalText(text []byte) error {
 		*s = SeverityNone
 	case "FATAL", "FTL":
 		*s = SeverityFatal
+	case "PANIC", "PNC":
+		*s = SeverityPanic
 	case "ERROR", "ERR":
 		*s = SeverityError
 	case "WARNING", "WRN", "WARN":
@@ -0,0 +1,481 @@
+package xlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var (
+	ErrSpoolFull = errors.New("spool full")
+)
+
+const (
+	spoolSegmentExt  = ".seg"
+	spoolAckFileName = "ack"
+)
+
+// SpoolOptions defines several options of SpoolOutput.
+type SpoolOptions struct {
+	// Dir is the directory to store the segment files. It is created if it doesn't exist.
+	Dir string
+
+	// SegmentSize is the maximum size of a segment file in bytes. By default, 4 MiB.
+	SegmentSize int64
+
+	// MaxBytes is the maximum total size of the segment files in bytes. The logs exceeding the limit are dropped.
+	// By default, 0 that means unlimited.
+	MaxBytes int64
+
+	// Sync syncs the segment file to the disk after every single log.
+	Sync bool
+
+	// RetryDelay is the delay before trying again to deliver a log which the output fails to write.
+	// By default, 1s.
+	RetryDelay time.Duration
+}
+
+// SpoolOutput is an implementation of ErrorOutput that appends the logs as JSON lines to the segment files on the
+// local disk, and delivers them asynchronously to the given output. A log is acknowledged when the output writes it;
+// if the output is an ErrorOutput, when its TryLog succeeds, otherwise when its Log returns. SpoolOutput replays
+// the logs which aren't acknowledged when it is created again on the same directory, so the delivery is at least
+// once. The delivered segment files are deleted.
+type SpoolOutput struct {
+	dropped    uint64 // accessed atomically, must be first for 64-bit alignment on 32-bit platforms
+	mu         sync.Mutex
+	output     Output
+	opts       SpoolOptions
+	segments   []uint64
+	writeFile  *os.File
+	writeSize  int64
+	totalSize  int64
+	readSeg    uint64
+	readOffset int64
+	signal     chan struct{}
+	empty      chan struct{}
+	isEmpty    bool
+	closed     bool
+	ctx        context.Context
+	ctxCancel  context.CancelFunc
+	done       chan struct{}
+	onError    *func(error)
+}
+
+// NewSpoolOutput creates a new SpoolOutput by the given output, and starts delivering the logs which aren't
+// acknowledged in the directory.
+func NewSpoolOutput(output Output, opts SpoolOptions) (s *SpoolOutput, err error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 4 << 20
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	s = &SpoolOutput{
+		output: output,
+		opts:   opts,
+		signal: make(chan struct{}, 1),
+		empty:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err = os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create spool directory: %w", err)
+	}
+	if err = s.load(); err != nil {
+		return nil, err
+	}
+	if err = s.rotate(); err != nil {
+		return nil, err
+	}
+	s.updateEmpty()
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	go s.reader()
+	return s, nil
+}
+
+// Close closes SpoolOutput and the underlying output. The logs which aren't delivered remain in the directory to be
+// replayed. Closing SpoolOutput again does nothing.
+func (s *SpoolOutput) Close() error {
+	s.ctxCancel()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := closeOutput(s.output)
+	if s.writeFile != nil {
+		if e := s.writeFile.Close(); e != nil && err == nil {
+			err = e
+		}
+		s.writeFile = nil
+	}
+	if e := s.saveAck(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Log is implementation of Output.
+func (s *SpoolOutput) Log(log *Log) {
+	err := s.TryLog(log)
+	log.Release()
+	if err != nil {
+		reportError(&s.onError, err)
+	}
+}
+
+// TryLog is implementation of ErrorOutput.
+// It returns ErrSpoolFull if the total size of the segment files exceeds MaxBytes.
+func (s *SpoolOutput) TryLog(log *Log) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("unable to encode log: %w", err)
+	}
+	data = append(data, '\n')
+	size := int64(len(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeFile == nil {
+		return ErrOutputClosed
+	}
+	if s.opts.MaxBytes > 0 && s.totalSize+size > s.opts.MaxBytes {
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrSpoolFull
+	}
+	if s.writeSize > 0 && s.writeSize+size > s.opts.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.writeFile.Write(data)
+	s.writeSize += int64(n)
+	s.totalSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write segment: %w", err)
+	}
+	s.updateEmpty()
+	if s.opts.Sync {
+		if err := s.writeFile.Sync(); err != nil {
+			return fmt.Errorf("unable to sync segment: %w", err)
+		}
+	}
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Flush is implementation of Flusher.
+// It syncs the segment file to the disk, waits until all the logs are delivered, and then flushes the underlying
+// output.
+func (s *SpoolOutput) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	var err error
+	if s.writeFile != nil {
+		err = s.writeFile.Sync()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to sync segment: %w", err)
+	}
+	if err := s.WaitForEmpty(ctx); err != nil {
+		return err
+	}
+	return flushOutput(ctx, s.output)
+}
+
+// SetErrorReporter is implementation of ErrorReporter.
+func (s *SpoolOutput) SetErrorReporter(f func(error)) {
+	s.SetOnError(f)
+	setErrorReporter(s.output, f)
+}
+
+// Dropped returns the number of the logs dropped because of MaxBytes.
+func (s *SpoolOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// WaitForEmpty waits until all the logs are delivered by given context.
+func (s *SpoolOutput) WaitForEmpty(ctx context.Context) error {
+	s.mu.Lock()
+	empty := s.empty
+	s.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-empty:
+		return nil
+	}
+}
+
+// SetOnError sets a function to call when error occurs.
+// It returns underlying SpoolOutput.
+func (s *SpoolOutput) SetOnError(f func(error)) *SpoolOutput {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&s.onError)), unsafe.Pointer(&f))
+	return s
+}
+
+// load loads the segment list and the acknowledged position from the directory.
+func (s *SpoolOutput) load() error {
+	infos, err := ioutil.ReadDir(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("unable to read spool directory: %w", err)
+	}
+	sizes := make(map[uint64]int64)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seg, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, seg)
+		sizes[seg] = info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i] < s.segments[j]
+	})
+
+	if data, err := ioutil.ReadFile(filepath.Join(s.opts.Dir, spoolAckFileName)); err == nil {
+		if _, err := fmt.Sscanf(string(data), "%d %d", &s.readSeg, &s.readOffset); err != nil {
+			return fmt.Errorf("unable to parse spool ack file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read spool ack file: %w", err)
+	}
+
+	segments := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg < s.readSeg {
+			if err := os.Remove(s.segmentPath(seg)); err != nil {
+				return fmt.Errorf("unable to remove delivered segment: %w", err)
+			}
+			continue
+		}
+		segments = append(segments, seg)
+		s.totalSize += sizes[seg]
+	}
+	s.segments = segments
+	if len(s.segments) > 0 && s.readSeg < s.segments[0] {
+		s.readSeg, s.readOffset = s.segments[0], 0
+	}
+	return nil
+}
+
+// rotate closes the current segment file, and creates the next one.
+func (s *SpoolOutput) rotate() error {
+	seg := s.readSeg
+	if len(s.segments) > 0 {
+		seg = s.segments[len(s.segments)-1] + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seg), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create segment: %w", err)
+	}
+	if s.writeFile != nil {
+		_ = s.writeFile.Close()
+	}
+	s.writeFile = f
+	s.writeSize = 0
+	s.segments = append(s.segments, seg)
+	return nil
+}
+
+// updateEmpty closes the empty channel when all the logs are delivered, and creates a new one when a log is written
+// after that. It must be called with s.mu held after changing the read or write position.
+func (s *SpoolOutput) updateEmpty() {
+	empty := s.readSeg == s.writeSeg() && s.readOffset >= s.writeSize
+	if empty == s.isEmpty {
+		return
+	}
+	s.isEmpty = empty
+	if empty {
+		close(s.empty)
+	} else {
+		s.empty = make(chan struct{})
+	}
+}
+
+// writeSeg returns the current segment which is written.
+func (s *SpoolOutput) writeSeg() uint64 {
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *SpoolOutput) segmentPath(seg uint64) string {
+	return filepath.Join(s.opts.Dir, fmt.Sprintf("%020d%s", seg, spoolSegmentExt))
+}
+
+// saveAck saves the acknowledged position into the ack file atomically.
+func (s *SpoolOutput) saveAck() error {
+	path := filepath.Join(s.opts.Dir, spoolAckFileName)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(fmt.Sprintf("%d %d\n", s.readSeg, s.readOffset)), 0644); err != nil {
+		return fmt.Errorf("unable to write spool ack file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("unable to write spool ack file: %w", err)
+	}
+	return nil
+}
+
+func (s *SpoolOutput) reader() {
+	defer close(s.done)
+	for s.ctx.Err() == nil {
+		s.mu.Lock()
+		seg, offset := s.readSeg, s.readOffset
+		s.mu.Unlock()
+		if !s.readSegment(seg, offset) {
+			return
+		}
+	}
+}
+
+// readSegment delivers the logs of the segment from the offset. It returns false if SpoolOutput is closed.
+func (s *SpoolOutput) readSegment(seg uint64, offset int64) bool {
+	f, err := os.Open(s.segmentPath(seg))
+	if err != nil {
+		reportError(&s.onError, fmt.Errorf("unable to open segment: %w", err))
+		return s.sleep(s.opts.RetryDelay)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		reportError(&s.onError, fmt.Errorf("unable to seek segment: %w", err))
+		return s.sleep(s.opts.RetryDelay)
+	}
+	br := bufio.NewReader(f)
+	unsaved, final := 0, false
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == nil {
+			if !s.deliver(line) {
+				return false
+			}
+			offset += int64(len(line))
+			s.mu.Lock()
+			s.readOffset = offset
+			s.updateEmpty()
+			if unsaved++; unsaved >= 100 {
+				unsaved = 0
+				if err := s.saveAck(); err != nil {
+					reportError(&s.onError, err)
+				}
+			}
+			s.mu.Unlock()
+			continue
+		}
+		if err != io.EOF {
+			reportError(&s.onError, fmt.Errorf("unable to read segment: %w", err))
+			return s.sleep(s.opts.RetryDelay)
+		}
+
+		s.mu.Lock()
+		rotated := s.writeSeg() != seg
+		if rotated && final {
+			if len(line) > 0 {
+				reportError(&s.onError, fmt.Errorf("incomplete log at the end of segment %d", seg))
+			}
+			s.finishSegment(seg)
+			s.mu.Unlock()
+			return true
+		}
+		if unsaved > 0 {
+			unsaved = 0
+			if err := s.saveAck(); err != nil {
+				reportError(&s.onError, err)
+			}
+		}
+		s.mu.Unlock()
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			reportError(&s.onError, fmt.Errorf("unable to seek segment: %w", err))
+			return s.sleep(s.opts.RetryDelay)
+		}
+		br.Reset(f)
+		if rotated {
+			// the segment can't grow anymore, read it once more to the end.
+			final = true
+			continue
+		}
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-s.signal:
+		}
+	}
+}
+
+// finishSegment removes the delivered segment, and moves the acknowledged position to the next segment.
+func (s *SpoolOutput) finishSegment(seg uint64) {
+	for i, seg2 := range s.segments {
+		if seg2 == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	if info, err := os.Stat(s.segmentPath(seg)); err == nil {
+		s.totalSize -= info.Size()
+	}
+	if err := os.Remove(s.segmentPath(seg)); err != nil {
+		reportError(&s.onError, fmt.Errorf("unable to remove delivered segment: %w", err))
+	}
+	s.readSeg, s.readOffset = s.segments[0], 0
+	s.updateEmpty()
+	if err := s.saveAck(); err != nil {
+		reportError(&s.onError, err)
+	}
+}
+
+// deliver delivers the encoded log to the output, retries until it is acknowledged. It returns false if SpoolOutput
+// is closed.
+func (s *SpoolOutput) deliver(data []byte) bool {
+	for {
+		log := newLog()
+		if err := log.UnmarshalJSON(data); err != nil {
+			log.Release()
+			reportError(&s.onError, fmt.Errorf("unable to decode log: %w", err))
+			return true
+		}
+		errOutput, ok := s.output.(ErrorOutput)
+		if !ok {
+			s.output.Log(log)
+			return true
+		}
+		err := errOutput.TryLog(log)
+		log.Release()
+		if err == nil {
+			return true
+		}
+		reportError(&s.onError, err)
+		if !s.sleep(s.opts.RetryDelay) {
+			return false
+		}
+	}
+}
+
+// sleep sleeps for the duration. It returns false if SpoolOutput is closed.
+func (s *SpoolOutput) sleep(d time.Duration) bool {
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
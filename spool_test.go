@@ -0,0 +1,179 @@
+package xlog_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func TestSpoolOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := xlog.SpoolOptions{
+		Dir:         dir,
+		SegmentSize: 256,
+		RetryDelay:  time.Millisecond,
+	}
+
+	failing := &recordOutput{failing: true}
+	spool, err := xlog.NewSpoolOutput(failing, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := xlog.New(spool, xlog.SeverityInfo, 0)
+	for i := 0; i < 10; i++ {
+		logger.Infof("log %d.", i)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	record := &recordOutput{}
+	spool, err = xlog.NewSpoolOutput(record, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetOutput(spool)
+	logger.Info("log 10.")
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := spool.WaitForEmpty(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := record.Messages()
+	if len(messages) != 11 {
+		t.Fatalf("delivered %d logs, want 11", len(messages))
+	}
+	for i, msg := range messages {
+		if want := fmt.Sprintf("log %d.", i); msg != want {
+			t.Errorf("log %d %q, want %q", i, msg, want)
+		}
+	}
+
+	record = &recordOutput{}
+	spool, err = xlog.NewSpoolOutput(record, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(record.Messages()); n != 0 {
+		t.Errorf("replayed %d acknowledged logs, want 0", n)
+	}
+}
+
+func TestSpoolOutput_maxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var lastErr error
+	spool, err := xlog.NewSpoolOutput(&recordOutput{failing: true}, xlog.SpoolOptions{
+		Dir:        dir,
+		MaxBytes:   512,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool.SetOnError(func(err error) {
+		if errors.Is(err, xlog.ErrSpoolFull) {
+			lastErr = err
+		}
+	})
+	defer spool.Close()
+	logger := xlog.New(spool, xlog.SeverityInfo, 0)
+	for i := 0; i < 10; i++ {
+		logger.Info("spool is full.")
+	}
+	if spool.Dropped() == 0 {
+		t.Error("no dropped logs")
+	}
+	if lastErr == nil {
+		t.Error("no ErrSpoolFull")
+	}
+}
+
+func TestSpoolOutput_Close(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var closed int32
+	record := &recordOutput{}
+	spool, err := xlog.NewSpoolOutput(&closerOutput{Output: record, closed: &closed}, xlog.SpoolOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	xlog.New(spool, xlog.SeverityInfo, 0).Info("flushed.")
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := spool.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(record.Messages()); n != 1 {
+		t.Errorf("delivered %d logs, want 1", n)
+	}
+	for i := 0; i < 2; i++ {
+		if err := spool.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed != 1 {
+		t.Errorf("closed the output %d times, want 1", closed)
+	}
+}
+
+// jsonOutput keeps the JSON encoding of the last log.
+type jsonOutput struct {
+	data []byte
+}
+
+func (j *jsonOutput) Log(log *xlog.Log) {
+	j.data, _ = json.Marshal(log)
+	log.Release()
+}
+
+func TestLog_MarshalJSON(t *testing.T) {
+	output := &jsonOutput{}
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger.WithFieldKeyVals("key1", "value1", "key2", 2).Warning("json.")
+	b := output.data
+
+	var log xlog.Log
+	if err := json.Unmarshal(b, &log); err != nil {
+		t.Fatal(err)
+	}
+	if string(log.Message) != "json." {
+		t.Errorf("message %q, want %q", log.Message, "json.")
+	}
+	if log.Severity != xlog.SeverityWarning {
+		t.Errorf("severity %v, want %v", log.Severity, xlog.SeverityWarning)
+	}
+	if len(log.Fields) != 2 || log.Fields[0].Key != "key1" || log.Fields[0].Value != "value1" ||
+		log.Fields[1].Value != json.Number("2") {
+		t.Errorf("fields %v", log.Fields)
+	}
+	if log.StackCaller.Line == 0 {
+		t.Error("no caller")
+	}
+}
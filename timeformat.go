@@ -0,0 +1,67 @@
+package xlog
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimeFormatKind is the kind of TimeFormat.
+type TimeFormatKind int
+
+const (
+	// TimeFormatDefault writes the date and the time by the flags: 2009/01/23 01:23:23.123123
+	TimeFormatDefault TimeFormatKind = iota
+
+	// TimeFormatLayout writes the time by the layout of TimeFormat like time.RFC3339Nano
+	TimeFormatLayout
+
+	// TimeFormatUnix writes the Unix time in seconds: 1232673803
+	TimeFormatUnix
+
+	// TimeFormatUnixMilli writes the Unix time in milliseconds: 1232673803123
+	TimeFormatUnixMilli
+
+	// TimeFormatUnixNano writes the Unix time in nanoseconds: 1232673803123123123
+	TimeFormatUnixNano
+)
+
+// TimeFormat defines the format of the time of Log for an Output.
+// The zero value is the default format of the text form of Log.
+type TimeFormat struct {
+	// Kind is the kind of the format.
+	Kind TimeFormatKind
+
+	// Layout is the layout of time.Format for TimeFormatLayout.
+	Layout string
+
+	// Location is the time zone of the time. By default, nil that means the local time zone, or UTC if the Log has
+	// FlagUTC.
+	Location *time.Location
+}
+
+// in returns tm in the location of the TimeFormat, or by FlagUTC.
+func (f *TimeFormat) in(tm time.Time, flags Flag) time.Time {
+	if f.Location != nil {
+		return tm.In(f.Location)
+	}
+	if flags&FlagUTC != 0 {
+		return tm.UTC()
+	}
+	return tm.Local()
+}
+
+// appendTime appends tm to b by the TimeFormat. The flags define the date and time parts for TimeFormatDefault.
+func (f *TimeFormat) appendTime(b []byte, tm time.Time, flags Flag) []byte {
+	switch f.Kind {
+	case TimeFormatLayout:
+		return f.in(tm, flags).AppendFormat(b, f.Layout)
+	case TimeFormatUnix:
+		return strconv.AppendInt(b, tm.Unix(), 10)
+	case TimeFormatUnixMilli:
+		return strconv.AppendInt(b, tm.UnixNano()/1e6, 10)
+	case TimeFormatUnixNano:
+		return strconv.AppendInt(b, tm.UnixNano(), 10)
+	default:
+		return appendFlagTime(b, f.in(tm, flags), flags)
+	}
+}
@@ -0,0 +1,37 @@
+package xlog_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/goinsane/xlog"
+)
+
+func ExampleTextOutput_SetTimeFormat() {
+	output := xlog.NewTextOutput(os.Stdout)
+	logger := xlog.New(output, xlog.SeverityInfo, 0).
+		WithTime(time.Date(2009, 1, 23, 1, 23, 23, 123123123, time.UTC))
+	logger.SetFlags(xlog.FlagDate | xlog.FlagTime | xlog.FlagSeverity)
+
+	for _, timeFormat := range []xlog.TimeFormat{
+		{Location: time.UTC},
+		{Location: time.FixedZone("+03", 3*60*60)},
+		{Kind: xlog.TimeFormatLayout, Layout: time.RFC3339Nano, Location: time.UTC},
+		{Kind: xlog.TimeFormatLayout, Layout: "Jan _2 15:04:05.000 MST", Location: time.FixedZone("EET", 2*60*60)},
+		{Kind: xlog.TimeFormatUnix},
+		{Kind: xlog.TimeFormatUnixMilli},
+		{Kind: xlog.TimeFormatUnixNano},
+	} {
+		output.SetTimeFormat(timeFormat)
+		logger.Info("time format.")
+	}
+
+	// Output:
+	// 2009/01/23 01:23:23 INFO - time format.
+	// 2009/01/23 04:23:23 INFO - time format.
+	// 2009-01-23T01:23:23.123123123Z INFO - time format.
+	// Jan 23 03:23:23.123 EET INFO - time format.
+	// 1232673803 INFO - time format.
+	// 1232673803123 INFO - time format.
+	// 1232673803123123123 INFO - time format.
+}
@@ -1,11 +1,21 @@
 package xlog
 
 import (
+	"context"
 	"go/build"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/goinsane/erf"
 )
 
+// maxPooledBufferSize is the maximum capacity of buffers which are put back into the pools.
+const maxPooledBufferSize = 64 << 10
+
 func itoa(buf *[]byte, i int, wid int) {
 	var b [20]byte
 	bp := len(b) - 1
@@ -42,33 +52,83 @@ func trimDirs(s string) string {
 	return s
 }
 
-type fmtState struct {
-	Buffer []byte
-	Wid    int
-	WidOK  bool
-	Prec   int
-	PrecOK bool
-	Flags  []rune
+func appendRepeat(b []byte, c byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		b = append(b, c)
+	}
+	return b
 }
 
-func (f *fmtState) Write(b []byte) (n int, err error) {
-	f.Buffer = b
-	return len(b), nil
+// callerOf returns the StackCaller without allocating. The argument skip is the number of stack frames to ascend, with
+// 0 identifying the caller of callerOf.
+func callerOf(skip int) erf.StackCaller {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) < 1 {
+		return erf.StackCaller{}
+	}
+	pc := pcs[0] - 1
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return erf.StackCaller{}
+	}
+	var c erf.StackCaller
+	c.PC = pc
+	c.Func = fn
+	c.Function = fn.Name()
+	c.Entry = fn.Entry()
+	c.File, c.Line = fn.FileLine(pc)
+	return c
 }
 
-func (f *fmtState) Width() (wid int, ok bool) {
-	return f.Wid, f.WidOK
+// reportError calls the function stored in onError if there is.
+func reportError(onError **func(error), err error) {
+	f := (*func(error))(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(onError))))
+	if f != nil && *f != nil {
+		(*f)(err)
+	}
 }
 
-func (f *fmtState) Precision() (prec int, ok bool) {
-	return f.Prec, f.PrecOK
+type buffer struct {
+	b []byte
 }
 
-func (f *fmtState) Flag(c int) bool {
-	for _, flag := range f.Flags {
-		if int(flag) == c {
-			return true
+var bufferPool = &sync.Pool{
+	New: func() interface{} {
+		return &buffer{
+			b: make([]byte, 0, 1024),
 		}
+	},
+}
+
+func getBuffer() *buffer {
+	return bufferPool.Get().(*buffer)
+}
+
+func putBuffer(buf *buffer) {
+	if cap(buf.b) > maxPooledBufferSize {
+		return
+	}
+	buf.b = buf.b[:0]
+	bufferPool.Put(buf)
+}
+
+// Write is implementation of io.Writer.
+func (buf *buffer) Write(p []byte) (n int, err error) {
+	buf.b = append(buf.b, p...)
+	return len(p), nil
+}
+
+// waitGroupContext waits for wg by given context.
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
 	}
-	return false
 }
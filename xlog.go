@@ -2,8 +2,10 @@
 package xlog
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/goinsane/erf"
@@ -14,6 +16,7 @@ var (
 	defaultOutput       = NewTextOutput(defaultOutputWriter)
 	defaultOutputWriter = os.Stderr
 	defaultPCSize       = erf.DefaultPCSize
+	defaultFatalTimeout = 5 * time.Second
 )
 
 // DefaultLogger returns the default Logger.
@@ -26,22 +29,43 @@ func DefaultOutput() *TextOutput {
 	return defaultOutput
 }
 
-// Fatal logs to the FATAL severity logs to the default Logger, then calls os.Exit(1).
+// Fatal logs to the FATAL severity logs to the default Logger, flushes and closes the default Logger's output, then
+// calls the exit function with code 1.
 func Fatal(args ...interface{}) {
 	defaultLogger.log(SeverityFatal, args...)
-	os.Exit(1)
+	defaultLogger.exit()
 }
 
-// Fatalf logs to the FATAL severity logs to the default Logger, then calls os.Exit(1).
+// Fatalf logs to the FATAL severity logs to the default Logger, flushes and closes the default Logger's output, then
+// calls the exit function with code 1.
 func Fatalf(format string, args ...interface{}) {
 	defaultLogger.logf(SeverityFatal, format, args...)
-	os.Exit(1)
+	defaultLogger.exit()
 }
 
-// Fatalln logs to the FATAL severity logs to the default Logger, then calls os.Exit(1).
+// Fatalln logs to the FATAL severity logs to the default Logger, flushes and closes the default Logger's output, then
+// calls the exit function with code 1.
 func Fatalln(args ...interface{}) {
 	defaultLogger.logln(SeverityFatal, args...)
-	os.Exit(1)
+	defaultLogger.exit()
+}
+
+// Panic creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs to the default Logger, then
+// panics with the new *erf.Erf.
+func Panic(args ...interface{}) {
+	panic(defaultLogger.logPanic(erf.New(fmt.Sprint(args...)).CopyByTop(1)))
+}
+
+// Panicf creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs to the default Logger, then
+// panics with the new *erf.Erf.
+func Panicf(format string, args ...interface{}) {
+	panic(defaultLogger.logPanic(erf.Newf(format, args...).CopyByTop(1)))
+}
+
+// Panicln creates a new *erf.Erf by given arguments. It logs to the PANIC severity logs to the default Logger, then
+// panics with the new *erf.Erf.
+func Panicln(args ...interface{}) {
+	panic(defaultLogger.logPanic(erf.New(strings.TrimSuffix(fmt.Sprintln(args...), "\n")).CopyByTop(1)))
 }
 
 // Error logs to the ERROR severity logs to the default Logger.
@@ -106,17 +130,17 @@ func Debugln(args ...interface{}) {
 
 // Print logs a log which has the default Logger's print severity to the default Logger.
 func Print(args ...interface{}) {
-	defaultLogger.log(defaultLogger.printSeverity, args...)
+	defaultLogger.log(defaultLogger.loadConfig().printSeverity, args...)
 }
 
 // Printf logs a log which has the default Logger's print severity to the default Logger.
 func Printf(format string, args ...interface{}) {
-	defaultLogger.logf(defaultLogger.printSeverity, format, args...)
+	defaultLogger.logf(defaultLogger.loadConfig().printSeverity, format, args...)
 }
 
 // Println logs a log which has the default Logger's print severity to the default Logger.
 func Println(args ...interface{}) {
-	defaultLogger.logln(defaultLogger.printSeverity, args...)
+	defaultLogger.logln(defaultLogger.loadConfig().printSeverity, args...)
 }
 
 // SetOutput sets the default Logger's output.
@@ -157,6 +181,29 @@ func SetPrintSeverity(printSeverity Severity) *Logger {
 	return defaultLogger.SetPrintSeverity(printSeverity)
 }
 
+// SetExitFunc sets the function which the default Logger's Fatal methods call after flushing and closing the output.
+// If f is nil, it sets os.Exit.
+// It returns the default Logger.
+// By default, os.Exit.
+func SetExitFunc(f func(code int)) *Logger {
+	return defaultLogger.SetExitFunc(f)
+}
+
+// SetFatalTimeout sets the timeout of flushing and closing the default Logger's output in Fatal methods.
+// If fatalTimeout is 0 or less, it sets the default.
+// It returns the default Logger.
+// By default, 5s.
+func SetFatalTimeout(fatalTimeout time.Duration) *Logger {
+	return defaultLogger.SetFatalTimeout(fatalTimeout)
+}
+
+// SetLimits sets the size limits of the default Logger's logs.
+// It returns the default Logger.
+// By default, unlimited.
+func SetLimits(limits Limits) *Logger {
+	return defaultLogger.SetLimits(limits)
+}
+
 // SetStackTraceSeverity sets the default Logger's severity level which saves stack trace into Log.
 // If stackTraceSeverity is invalid, it sets SeverityNone.
 // It returns the default Logger.
@@ -237,6 +284,9 @@ func Reset() {
 	SetFlags(FlagDefault)
 	SetPrintSeverity(SeverityInfo)
 	SetStackTraceSeverity(SeverityNone)
+	SetExitFunc(nil)
+	SetFatalTimeout(defaultFatalTimeout)
+	SetLimits(Limits{})
 	SetOutputWriter(defaultOutputWriter)
 	SetOutputFlags(0)
 }
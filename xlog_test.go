@@ -1,6 +1,7 @@
 package xlog_test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -11,6 +12,9 @@ import (
 
 var (
 	testTime, _ = time.ParseInLocation("2006-01-02T15:04:05", "2010-11-12T13:14:15", time.Local)
+
+	// raceEnabled is true if the race detector is enabled. sync.Pool drops items randomly in race mode.
+	raceEnabled = false
 )
 
 // resetForTest resets xlog to run new test.
@@ -186,6 +190,70 @@ func ExampleLogger() {
 	// ERROR - this is error log, verbosity 2.
 }
 
+func ExampleMultiOutput() {
+	output1 := xlog.NewTextOutput(os.Stdout).SetFlags(xlog.FlagSeverity)
+	output2 := xlog.NewTextOutput(os.Stdout)
+	logger := xlog.New(xlog.MultiOutput(output1, output2), xlog.SeverityInfo, 0)
+	logger.SetFlags(0)
+
+	logger.Info("this is info log, verbosity 0.")
+
+	// Output:
+	// INFO - this is info log, verbosity 0.
+	// this is info log, verbosity 0.
+}
+
+func TestLogger_zeroValue(t *testing.T) {
+	var logger xlog.Logger
+	logger.Info("no output.")
+	logger.WithPrefix("prefix: ").Errorf("no output: %d", 1)
+	logger.V(1).Println("no output.")
+
+	var buf bytes.Buffer
+	output := xlog.NewTextOutput(&buf)
+	output.SetFlags(xlog.FlagSeverity)
+	logger.SetOutput(output).SetSeverity(xlog.SeverityInfo)
+	logger.Info("zero value.")
+	if got, want := buf.String(), "INFO - zero value.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// forwardOutput passes the logs to the inner output, and then records their messages.
+type forwardOutput struct {
+	output   xlog.Output
+	messages []string
+}
+
+func (f *forwardOutput) Log(log *xlog.Log) {
+	f.output.Log(log)
+	f.messages = append(f.messages, string(log.Message))
+}
+
+func TestLogger_forwardOutput(t *testing.T) {
+	output := &forwardOutput{output: xlog.NewTextOutput(ioutil.Discard)}
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger.Info("first.")
+	logger.Info("second.")
+	if len(output.messages) != 2 || output.messages[0] != "first." || output.messages[1] != "second." {
+		t.Errorf("messages %q", output.messages)
+	}
+}
+
+func TestLogger_Info_allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("skipping in race mode")
+	}
+	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
+	logger = logger.WithFieldKeyVals("key1", "value1", "key2", 2, "key3", 3.5, "key4", true)
+	allocs := testing.AllocsPerRun(100, func() {
+		logger.Info("benchmark")
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs per run, want 0", allocs)
+	}
+}
+
 func BenchmarkLogger_Info(b *testing.B) {
 	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
 	b.ResetTimer()
@@ -210,6 +278,16 @@ func BenchmarkLogger_Infoln(b *testing.B) {
 	}
 }
 
+func BenchmarkLogger_Info_withFields(b *testing.B) {
+	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
+	logger = logger.WithFieldKeyVals("key1", "value1", "key2", 2, "key3", 3.5, "key4", true)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark")
+	}
+}
+
 func BenchmarkLogger_Info_withStackTrace(b *testing.B) {
 	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
 	logger.SetStackTraceSeverity(xlog.SeverityInfo)
@@ -294,3 +372,60 @@ func BenchmarkLogger_WithFieldKeyVals(b *testing.B) {
 		logger.WithFieldKeyVals("key1", "value1")
 	}
 }
+
+func BenchmarkLogger_Info_parallel(b *testing.B) {
+	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("benchmark")
+		}
+	})
+}
+
+func BenchmarkLogger_Info_withFields_parallel(b *testing.B) {
+	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
+	logger = logger.WithFieldKeyVals("key1", "value1", "key2", 2)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("benchmark")
+		}
+	})
+}
+
+func BenchmarkLogger_Debug_disabled_parallel(b *testing.B) {
+	logger := xlog.New(xlog.NewTextOutput(ioutil.Discard), xlog.SeverityInfo, 0)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Debug("benchmark")
+		}
+	})
+}
+
+func BenchmarkMultiOutput_1(b *testing.B) {
+	output := xlog.MultiOutput(xlog.NewTextOutput(ioutil.Discard))
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger = logger.WithFieldKeyVals("key1", "value1", "key2", 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark")
+	}
+}
+
+func BenchmarkMultiOutput_5(b *testing.B) {
+	outputs := make([]xlog.Output, 5)
+	for i := range outputs {
+		outputs[i] = xlog.NewTextOutput(ioutil.Discard)
+	}
+	output := xlog.MultiOutput(outputs...)
+	logger := xlog.New(output, xlog.SeverityInfo, 0)
+	logger = logger.WithFieldKeyVals("key1", "value1", "key2", 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark")
+	}
+}